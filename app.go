@@ -1,15 +1,18 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"regexp"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 )
 
 const (
@@ -21,25 +24,131 @@ the include parameter with playlist names to specify the playlist to export.
 Usage of exclude parameter will override any playlist included using the flag 
 or parameter.
 
+Playlists are selected by name, or by one of these selectors, for include and exclude alike:
+    Best of *                   A name with * ? or [...] is a glob pattern, unless a playlist has exactly that name.
+    name:<name>                 The exact name, even with wildcards.
+    glob:<pattern>              A glob pattern.
+    re:<regular expression>     A regular expression, matching anywhere in the name.
+    folder:<path>               The folder with the path, e.g. folder:"Archive/2019"
+    id:<persistent id>          The playlist or folder with the persistent id.
+A selected folder includes all the playlists inside it, at any depth. The include parameters add to
+the -include flags.
+
 Flags:
-    -library <file path>        Path to iTunes Music Library XML File.
+    -library <file path>        Path to iTunes Music Library XML File, or a JSON file written by the dump command.
+                                On Linux it defaults to $ITUNES_LIBRARY, then the path in
+                                ~/.config/itunesexport/library, then the first library found in the Windows home
+                                folder under WSL (including OneDrive), on drives mounted under /mnt and
+                                /media/$USER, and in Wine prefixes.
     -output <file path>         Path where the playlists should be written.
-    -type <M3U|EXT|WPL|ZPL>     Type of playlist file to write.  Defaults to M3U
+    -type <M3U|EXT|WPL|ZPL|CSV|TSV>
+                                Type of playlist file to write.  Defaults to M3U
                                 EXT = M3U Extended, WPL = Windows Playlist, ZPL = Zune Playlist
+                                CSV and TSV write one row per playlist entry with the selected -columns.
+    -columns <columns>          Comma separated columns for CSV and TSV. Defaults to name,artist,album,genre,year,time,location
+                                Available: trackid, persistentid, name, artist, albumartist, composer, album, genre,
+                                kind, year, tracknumber, discnumber, time, totaltime, starttime, stoptime, rating,
+                                playcount, skipcount, dateadded, datemodified, playdate, skipdate, comments,
+                                grouping, location
     -includeAll                 Include all user defined playlists.
     -includeAllWithBuiltin      Include All playlists, including iTunes defined playlists
-    -includePlaylistWithRegex   Include all playlists matching the provided regular expression
+    -includePlaylistWithRegex   Include all playlists matching the provided regular expression, like include re:<regex>
+    -ignoreCase                 Match the include and exclude parameters case-insensitively.
+    -interactive                Pick the playlists and folders in a tree in the terminal, with their track counts.
+                                Space selects, / searches, enter exports the selection and p prints the command
+                                line that exports it instead.
     -copy <COPY TYPE>           Copy the music tracks as well, according the the COPY TYPE scheme...
         NONE                    (default) The music files will not be copied.	                            
         PLAYLIST                Copies the music into a folder for each playlist.
         ITUNES                  Copies using the itunes music/<Artist>/<Album>/<Track> structure.
         FLAT                    Copies all the music into the output folder.
+    -linkMode <LINK MODE>       How -copy creates the music files. Files that cannot be linked, e.g. on
+                                another device, are copied instead.
+        copy                    (default) Copy the files.
+        hardlink                Create hard links to the original files.
+        symlink                 Create symbolic links to the original files.
+        reflink                 Clone the files on copy-on-write file systems such as Btrfs and XFS (Linux only).
+        auto                    Hard link if possible, otherwise reflink, otherwise copy. Tagged files are never
+                                hard linked.
+    -mtime <MTIME>              The modification time of copied files.
+        source                  (default) The modification time of the original file.
+        modified                The Date Modified of the track in iTunes.
+        added                   The Date Added of the track in iTunes.
+        now                     The time of the copy.
+    -fileMode <octal mode>      Permissions of the playlists and copied files, regardless of the umask.
+                                Without it, files get 0666 less the umask.
+    -dirMode <octal mode>       Permissions of the folders created, regardless of the umask.
+                                Without it, folders get 0777 less the umask.
+    -xattrs                     Also copy the extended attributes of the music files (Linux only).
+    -artwork                    With -copy ITUNES, write the cover art embedded in the music files as
+                                folder.jpg and cover.jpg into each album folder.
+    -artworkSize <pixels>       Scale the extracted cover art down so neither side exceeds this size.
+    -writeTags <fields>         Write iTunes metadata into the tags of copied files (never the originals).
+                                Comma separated list of ALL, name, artist, albumartist, album, genre,
+                                comments, grouping, work, rating and playcount. Requires -copy.
     -musicPath <new path>       Base path to the music files. This will override the Music Folder path from iTunes.
     -musicPathOrig <path>       When using -musicPath this allows you to override the Music Folder value that is replaced.
+    -rewrite <from>=<to>        Replace the start of the music file paths. May be given several times, the first
+                                matching rule applies, before -musicPath. Prefixes match whole folders, and
+                                re:<regex>=<replacement> rules may use capture groups, e.g.
+                                -rewrite 're:D:/iTunes/(Music|Podcasts)=/mnt/$1'
+                                Windows paths are matched case-insensitively.
+    -explainPath <track id>     Show how the path of a track is rewritten, instead of exporting.
     -includeFolders             Playlists within folders will include the full path in the name.
+    -exportFolders              Also write a playlist for each selected folder, with the tracks of all the
+                                playlists inside it, without duplicates.
     -pathSeparator <separator>  The character or string to use to separate path elements in the output playlist file.
-                                If not specified it will use the operating system's default value.
+                                If not specified it will use the separator of the -targetOS.
+    -targetOS <OS>              windows, mac or linux. Selects the path separator, \ for windows and / otherwise,
+                                and warns when the library paths will not work there. Defaults to the current
+                                operating system. Paths are not converted: libraries from Windows (drive letter
+                                and UNC paths) and macOS are read on any operating system, but their paths have
+                                to be mapped with -rewrite or -musicPath.
+    -extDirectives              With -type EXT, also write #PLAYLIST, #EXTALB, #EXTART, #EXTGENRE and #EXTIMG
+                                directives, and use the .m3u8 extension for playlists with non-ASCII names.
+    -pathStyle <style>          absolute (default) or relative. Relative paths are relative to the playlist file.
+    -encoding <UTF-8>           Write M3U and EXT playlists with the UTF-8 .m3u8 extension.
+    -profile <name>             Use the settings of a player profile: rockbox, navidrome or plex.
+                                Flags given explicitly override the profile.
+    -profiles <file path>       JSON file with additional profiles. Defaults to itunesexport/profiles.json
+                                in the user's configuration directory.
+    -watch                      Keep running and export again whenever the library file changes.
+    -watchDelay <duration>      Time to wait for the library file to stop changing before exporting. Defaults to 5s
+    -watchInterval <duration>   How often the library file is also polled, e.g. on network mounts. Defaults to 1m
+    -force                      Export every playlist, even if it has not changed since the last export.
+                                By default the last export is recorded in .itunesexport-state.json in the output
+                                folder, unchanged playlists are skipped, and playlist files of playlists that no
+                                longer exist or are no longer selected are removed.
+    -resume                     Continue an export that was interrupted, e.g. with Ctrl-C, skipping the playlists
+                                it already exported. Files being written when it was interrupted are removed.
+    -verify                     Read every copied file back and compare its sha256 with the source, retrying
+                                mismatches. Existing copies are checked too. The checksums are kept in
+                                .itunesexport-manifest in the output folder. Requires -copy.
     -flags                      Output the command line flags provided.
+
+Commands:
+    stats [-library <file path>] [-format text|json|csv] [-top <n>] [-output <file path>]
+                                Report library statistics instead of exporting playlists.
+    tracks [-library <file path>] [-playlist <name>] [-columns <columns>] [-format csv|tsv|text|json]
+           [-output <file path>]
+                                List the tracks of the library, or of one playlist or folder.
+    dump [-library <file path>] [-format json|ndjson] [-output <file path>]
+                                Write the library as JSON or newline delimited JSON. The JSON can be
+                                used with -library in place of the XML file.
+    export-sqlite [-library <file path>] <database file>
+                                Create or update a SQLite database with tracks, playlists, playlist_items
+                                and folders tables. Not available in the 32-bit Windows build.
+    diff [-format text|json] [-plays] [-output <file path>] <old library> <new library>
+                                Report tracks and playlists added, removed, changed or moved between two
+                                library snapshots. -plays also compares play and skip statistics.
+    verify <output folder>      Check the files of an export made with -verify against its manifest,
+                                without needing the source files. Exits with status 1 if any file is
+                                missing or differs.
+    list playlists [-library <file path>] [-format text|json] [-output <file path>]
+                                Show the tree of folders and playlists with their persistent IDs, Distinguished
+                                Kind, smart and folder flags, track counts and durations, and whether -includeAll
+                                exports them.
+    list tracks [<flags>]       The same as tracks.
 `
 	UsageErrorMessage = `Unable to parse command line parameters.
 %v
@@ -70,6 +179,32 @@ var (
 	musicPathOrig                  string
 	includeFolders                 bool
 	pathSeparator                  string
+	extDirectives                  bool
+	artwork                        bool
+	artworkSize                    int
+	writeTags                      string
+	pathStyle                      string
+	encoding                       string
+	profileName                    string
+	profilesPath                   string
+	columns                        string
+	watch                          bool
+	watchDelay                     time.Duration
+	watchInterval                  time.Duration
+	force                          bool
+	resume                         bool
+	verify                         bool
+	linkMode                       string
+	fileMode                       string
+	dirMode                        string
+	mtime                          string
+	xattrs                         bool
+	rewrites                       rewriteRules
+	explainPath                    string
+	targetOS                       string
+	exportFolders                  bool
+	ignoreCase                     bool
+	interactive                    bool
 	flagDebug                      bool
 
 	exportSettings ExportSettings
@@ -77,6 +212,10 @@ var (
 
 func main() {
 
+	if runCommand(os.Args[1:]) {
+		return
+	}
+
 	fmt.Printf("\niTunes Export (Go Version %v)\nSee http://www.ericdaugherty.com/dev/itunesexport/ for detailed instructions.\n\n", Version)
 
 	flags := flag.NewFlagSet("flags", flag.ContinueOnError)
@@ -88,11 +227,38 @@ func main() {
 	flags.BoolVar(&includeAllPlaylists, "includeAll", false, "")
 	flags.BoolVar(&includeAllWithBuiltinPlaylists, "includeAllWithBuiltin", false, "")
 	flags.StringVar(&includePlaylistWithRegex, "includePlaylistWithRegex", "", "")
+	flags.BoolVar(&ignoreCase, "ignoreCase", false, "")
+	flags.BoolVar(&interactive, "interactive", false, "")
 	flags.StringVar(&copyType, "copy", "NONE", "")
 	flags.StringVar(&musicPath, "musicPath", "", "")
 	flags.StringVar(&musicPathOrig, "musicPathOrig", "", "")
+	rewrites = nil
+	flags.Var(&rewrites, "rewrite", "")
+	flags.StringVar(&explainPath, "explainPath", "", "")
+	flags.StringVar(&targetOS, "targetOS", "", "")
 	flags.BoolVar(&includeFolders, "includeFolders", false, "")
+	flags.BoolVar(&exportFolders, "exportFolders", false, "")
 	flags.StringVar(&pathSeparator, "pathSeparator", "", "")
+	flags.BoolVar(&extDirectives, "extDirectives", false, "")
+	flags.BoolVar(&artwork, "artwork", false, "")
+	flags.IntVar(&artworkSize, "artworkSize", 0, "")
+	flags.StringVar(&writeTags, "writeTags", "", "")
+	flags.StringVar(&pathStyle, "pathStyle", "absolute", "")
+	flags.StringVar(&encoding, "encoding", "", "")
+	flags.StringVar(&profileName, "profile", "", "")
+	flags.StringVar(&profilesPath, "profiles", "", "")
+	flags.StringVar(&columns, "columns", DefaultColumns, "")
+	flags.BoolVar(&watch, "watch", false, "")
+	flags.DurationVar(&watchDelay, "watchDelay", 5*time.Second, "")
+	flags.DurationVar(&watchInterval, "watchInterval", time.Minute, "")
+	flags.BoolVar(&force, "force", false, "")
+	flags.BoolVar(&resume, "resume", false, "")
+	flags.BoolVar(&verify, "verify", false, "")
+	flags.StringVar(&linkMode, "linkMode", "copy", "")
+	flags.StringVar(&fileMode, "fileMode", "", "")
+	flags.StringVar(&dirMode, "dirMode", "", "")
+	flags.StringVar(&mtime, "mtime", "source", "")
+	flags.BoolVar(&xattrs, "xattrs", false, "")
 	flags.BoolVar(&flagDebug, "flags", false, "")
 
 	err := flags.Parse(os.Args[1:])
@@ -101,6 +267,12 @@ func main() {
 		commandLineErrorMessage = err.Error()
 	}
 
+	err = applyProfile(flags)
+	if err != nil {
+		commandLineError = true
+		commandLineErrorMessage = fmt.Sprintf("%v\n", err.Error())
+	}
+
 	if flagDebug {
 		fmt.Printf("Arguments: %v\n", os.Args[1:])
 		fmt.Printf(`
@@ -115,8 +287,36 @@ Music Path: '%s'
 Music Path Original: '%s'
 Include Folders: '%v'
 Path Separator: '%s'
+Ext Directives: '%v'
+Artwork: '%v'
+Artwork Size: '%v'
+Write Tags: '%s'
+Path Style: '%s'
+Encoding: '%s'
+Profile: '%s'
+Columns: '%s'
+Watch: '%v'
+Watch Delay: '%v'
+Watch Interval: '%v'
+Force: '%v'
+Resume: '%v'
+Verify: '%v'
+Link Mode: '%s'
+File Mode: '%s'
+Dir Mode: '%s'
+Mtime: '%s'
+Xattrs: '%v'
+Rewrite: '%v'
+Explain Path: '%s'
+Target OS: '%s'
+Export Folders: '%v'
+Ignore Case: '%v'
+Interactive: '%v'
 `, libraryPath, outputPath, exportType, includeAllPlaylists, includeAllWithBuiltinPlaylists,
-			includePlaylistWithRegex, copyType, musicPath, musicPathOrig, includeFolders, pathSeparator)
+			includePlaylistWithRegex, copyType, musicPath, musicPathOrig, includeFolders, pathSeparator, extDirectives,
+			artwork, artworkSize, writeTags, pathStyle, encoding, profileName, columns,
+			watch, watchDelay, watchInterval, force, resume, verify, linkMode, fileMode, dirMode, mtime, xattrs,
+			rewrites.String(), explainPath, targetOS, exportFolders, ignoreCase, interactive)
 	}
 
 	err = parseExportType()
@@ -125,12 +325,47 @@ Path Separator: '%s'
 		commandLineErrorMessage = fmt.Sprintf("%v\n", err.Error())
 	}
 
+	err = parsePathStyle()
+	if err != nil {
+		commandLineError = true
+		commandLineErrorMessage = fmt.Sprintf("%v\n", err.Error())
+	}
+
 	err = parseCopyType()
 	if err != nil {
 		commandLineError = true
 		commandLineErrorMessage = fmt.Sprintf("%v\n", err.Error())
 	}
 
+	exportSettings.TargetOS, err = parseTargetOS(targetOS)
+	if err != nil {
+		commandLineError = true
+		commandLineErrorMessage = fmt.Sprintf("%v\n", err.Error())
+	}
+
+	err = parseTagFields()
+	if err != nil {
+		commandLineError = true
+		commandLineErrorMessage = fmt.Sprintf("%v\n", err.Error())
+	}
+
+	err = parseLinkMode()
+	if err != nil {
+		commandLineError = true
+		commandLineErrorMessage = fmt.Sprintf("%v\n", err.Error())
+	}
+
+	err = parseFileAttributes()
+	if err != nil {
+		commandLineError = true
+		commandLineErrorMessage = fmt.Sprintf("%v\n", err.Error())
+	}
+
+	if verify && exportSettings.CopyType == COPY_NONE {
+		commandLineError = true
+		commandLineErrorMessage = "-verify requires -copy, as only copied files are verified\n"
+	}
+
 	var mode = ModeUnknown
 	for _, flagValue := range flags.Args() {
 		switch flagValue {
@@ -151,6 +386,11 @@ Path Separator: '%s'
 		}
 	}
 
+	if _, _, err := playlistSelectors(); err != nil {
+		commandLineError = true
+		commandLineErrorMessage = fmt.Sprintf("%v\n", err.Error())
+	}
+
 	if commandLineError {
 		fmt.Printf(UsageMessage, "itunesexport")
 		fmt.Printf(UsageErrorMessage, commandLineErrorMessage)
@@ -166,13 +406,82 @@ Path Separator: '%s'
 	}
 	libraryPath = filepath.Clean(libraryPath)
 
+	if interactive {
+		export, err := pickPlaylists(os.Args[1 : len(os.Args)-flags.NArg()])
+		if err != nil {
+			fmt.Println(err)
+		}
+		if !export {
+			return
+		}
+	}
+
 	fmt.Printf("Include: %v, Exclude %v ", includePlaylistNames, excludePlaylistNames)
 
+	// The first interrupt stops the export cleanly, a second one exits immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	err = runExport(ctx)
+	if err != nil {
+		fmt.Println(err)
+		if !watch || ctx.Err() != nil {
+			return
+		}
+	}
+
+	if watch {
+		err = watchLibrary(ctx, libraryPath, watchDelay, watchInterval, func() error { return runExport(ctx) })
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// pickPlaylists lets the user pick the playlists in the terminal, starting with those selected on the
+// command line. It either replaces the selection and reports that it should be exported, or prints the
+// command line exporting it, with the flags in args.
+func pickPlaylists(args []string) (bool, error) {
+	library, err := LoadLibrary(libraryPath)
+	if err != nil {
+		return false, err
+	}
+
+	result, selectors, err := runPicker(library, parsePlaylists(library))
+	if err != nil {
+		return false, err
+	}
+	switch result {
+	case PICK_EXPORT:
+		if len(selectors) == 0 {
+			return false, errors.New("No playlists selected.")
+		}
+		selectPickedPlaylists(selectors)
+		return true, nil
+	case PICK_PRINT:
+		fmt.Println(pickerCommandLine(filepath.Base(os.Args[0]), args, selectors))
+	}
+	return false, nil
+}
+
+// selectPickedPlaylists replaces the playlists selected on the command line with the picked selectors,
+// which name the picked playlists exactly, so -ignoreCase is turned off as well.
+func selectPickedPlaylists(selectors []string) {
+	includeAllPlaylists, includeAllWithBuiltinPlaylists, includePlaylistWithRegex = false, false, ""
+	includePlaylistNames, excludePlaylistNames = selectors, nil
+	ignoreCase = false
+}
+
+// runExport loads the library and exports the selected playlists using the parsed command line.
+func runExport(ctx context.Context) error {
 	fmt.Println("Loading Library:", libraryPath)
 	library, err := LoadLibrary(libraryPath)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return err
 	}
 	exportSettings.Library = library
 	fmt.Printf("Library loaded successfully with %v playlists and %v tracks.\n", len(library.Playlists), len(library.Tracks))
@@ -181,30 +490,86 @@ Path Separator: '%s'
 		if musicPathOrig != "" {
 			exportSettings.OriginalMusicPath = musicPathOrig
 		} else {
-			origMusicPath, err := url.QueryUnescape(library.MusicFolder)
+			origMusicPath, err := locationPath(library.MusicFolder)
 			if err != nil {
-				fmt.Printf("Error parsing Music Folder from library: %v\n", err)
-				return
+				return fmt.Errorf("Error parsing Music Folder from library: %v", err)
 			}
-			exportSettings.OriginalMusicPath = trimTrackLocationPrefix(origMusicPath)
+			exportSettings.OriginalMusicPath = origMusicPath
 		}
 	}
 	exportSettings.NewMusicPath = musicPath
+	exportSettings.RewriteRules = rewrites
+
+	if exportSettings.CopyType == COPY_NONE && len(exportSettings.musicPathRules()) == 0 {
+		if warning := originWarning(libraryOrigin(library), exportSettings.TargetOS); warning != "" {
+			fmt.Println(warning)
+		}
+	}
+
+	if explainPath != "" {
+		return explainTrackPath(os.Stdout, &exportSettings, library, explainPath)
+	}
 
 	exportSettings.OutputPath = outputPath
 	exportSettings.Playlists = parsePlaylists(exportSettings.Library)
 
-	exportSettings.PathSeparator = string(filepath.Separator)
+	exportSettings.PathSeparator = targetPathSeparator(exportSettings.TargetOS)
 	if len(pathSeparator) > 0 {
 		exportSettings.PathSeparator = pathSeparator
 	}
+	exportSettings.ExtDirectives = extDirectives
+	exportSettings.ExportFolders = exportFolders
+	exportSettings.Artwork = artwork
+	exportSettings.ArtworkSize = artworkSize
+
+	exportSettings.PlaylistStates, err = loadExportState(outputPath)
+	if err != nil {
+		fmt.Printf("Exporting all playlists: %v\n", err)
+		exportSettings.PlaylistStates = make(map[string]PlaylistState)
+	}
+	if force {
+		// Keep the recorded files, so playlists that are no longer exported are still removed.
+		for key, state := range exportSettings.PlaylistStates {
+			state.Hash = ""
+			exportSettings.PlaylistStates[key] = state
+		}
+	}
+
+	exportSettings.Manifest = nil
+	if verify {
+		exportSettings.Manifest, err = loadManifest(outputPath)
+		if err != nil {
+			return fmt.Errorf("Error reading manifest: %v", err)
+		}
+		// Whatever was verified is kept, even if the export fails.
+		defer func() {
+			if err := exportSettings.Manifest.Save(); err != nil {
+				fmt.Printf("Error saving manifest: %v\n", err)
+			}
+		}()
+	}
+
+	exportSettings.Journal, err = openJournal(outputPath, resume)
+	if err != nil {
+		return fmt.Errorf("Error opening export journal: %v", err)
+	}
 
 	fmt.Printf("Exporting %v playlists...\n", len(exportSettings.Playlists))
-	err = ExportPlaylists(&exportSettings, library)
+	err = ExportPlaylists(ctx, &exportSettings, library)
 	if err != nil {
-		fmt.Printf("Error Exporting Playlist: %v\n", err)
-		return
+		exportSettings.Journal.Close()
+		if ctx.Err() != nil {
+			return errors.New("Export interrupted. Run again with -resume to continue where it stopped.")
+		}
+		return fmt.Errorf("Error Exporting Playlist: %v", err)
+	}
+
+	err = saveExportState(outputPath, exportSettings.PlaylistStates)
+	if err != nil {
+		exportSettings.Journal.Close()
+		return fmt.Errorf("Error saving export state: %v", err)
 	}
+	return exportSettings.Journal.Remove()
 }
 
 func parseExportType() error {
@@ -221,9 +586,82 @@ func parseExportType() error {
 	case "ZPL":
 		exportSettings.ExportType = ZPL
 		exportSettings.Extension = "zpl"
+	case "CSV":
+		exportSettings.ExportType = CSV
+		exportSettings.Extension = "csv"
+	case "TSV":
+		exportSettings.ExportType = TSV
+		exportSettings.Extension = "tsv"
 	default:
 		return errors.New("Unknown Export Type: " + exportType)
 	}
+
+	switch strings.ToUpper(encoding) {
+	case "":
+	case "UTF-8", "UTF8":
+		if exportSettings.ExportType == M3U || exportSettings.ExportType == EXT {
+			exportSettings.Extension = "m3u8"
+		}
+	default:
+		return errors.New("Unknown Encoding: " + encoding)
+	}
+
+	var err error
+	exportSettings.Columns, err = parseColumns(columns)
+	return err
+}
+
+func parsePathStyle() error {
+	switch strings.ToLower(pathStyle) {
+	case "absolute":
+		exportSettings.RelativePaths = false
+	case "relative":
+		exportSettings.RelativePaths = true
+	default:
+		return errors.New("Unknown Path Style: " + pathStyle)
+	}
+	return nil
+}
+
+// applyProfile sets the values of the selected profile for every flag that was not given explicitly.
+func applyProfile(flags *flag.FlagSet) error {
+	if profileName == "" {
+		return nil
+	}
+
+	explicit := profilesPath != ""
+	path := profilesPath
+	if !explicit {
+		path = userProfilesPath()
+	}
+	profiles, err := loadProfiles(path, explicit)
+	if err != nil {
+		return err
+	}
+	profile, ok := profiles[strings.ToLower(profileName)]
+	if !ok {
+		return fmt.Errorf("Unknown Profile: %v. Available profiles: %v", profileName, strings.Join(profileNames(profiles), ", "))
+	}
+
+	setFlags := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+	apply := func(name string, value string, target *string) {
+		if value != "" && !setFlags[name] {
+			*target = value
+		}
+	}
+
+	apply("type", profile.Type, &exportType)
+	apply("pathStyle", profile.PathStyle, &pathStyle)
+	apply("pathSeparator", profile.PathSeparator, &pathSeparator)
+	apply("encoding", profile.Encoding, &encoding)
+	apply("musicPath", profile.MusicPath, &musicPath)
+	apply("musicPathOrig", profile.MusicPathOrig, &musicPathOrig)
+	if profile.ExtDirectives && !setFlags["extDirectives"] {
+		extDirectives = true
+	}
 	return nil
 }
 
@@ -243,49 +681,128 @@ func parseCopyType() error {
 	return nil
 }
 
+func parseLinkMode() error {
+	switch strings.ToLower(linkMode) {
+	case "copy":
+		exportSettings.LinkMode = LINK_COPY
+	case "hardlink":
+		exportSettings.LinkMode = LINK_HARDLINK
+	case "symlink":
+		exportSettings.LinkMode = LINK_SYMLINK
+	case "reflink":
+		exportSettings.LinkMode = LINK_REFLINK
+	case "auto":
+		exportSettings.LinkMode = LINK_AUTO
+	default:
+		return errors.New("Unknown Link Mode: " + linkMode)
+	}
+	if len(exportSettings.TagFields) > 0 && (exportSettings.LinkMode == LINK_HARDLINK || exportSettings.LinkMode == LINK_SYMLINK) {
+		return errors.New("-writeTags cannot be used with -linkMode " + linkMode + ", as it would modify the original files")
+	}
+	return nil
+}
+
+func parseFileAttributes() error {
+	exportSettings.FileMode, exportSettings.DirMode = 0, 0
+	if fileMode != "" {
+		mode, err := strconv.ParseUint(fileMode, 8, 32)
+		if err != nil || mode > 0777 {
+			return errors.New("Unknown File Mode: " + fileMode)
+		}
+		exportSettings.FileMode = os.FileMode(mode)
+	}
+	if dirMode != "" {
+		mode, err := strconv.ParseUint(dirMode, 8, 32)
+		if err != nil || mode > 0777 {
+			return errors.New("Unknown Dir Mode: " + dirMode)
+		}
+		exportSettings.DirMode = os.FileMode(mode)
+	}
+
+	switch strings.ToLower(mtime) {
+	case "source":
+		exportSettings.ModTime = MTIME_SOURCE
+	case "modified":
+		exportSettings.ModTime = MTIME_MODIFIED
+	case "added":
+		exportSettings.ModTime = MTIME_ADDED
+	case "now":
+		exportSettings.ModTime = MTIME_NOW
+	default:
+		return errors.New("Unknown Mtime: " + mtime)
+	}
+
+	if xattrs && !xattrsSupported {
+		return errors.New("-xattrs is not supported on this platform")
+	}
+	exportSettings.Xattrs = xattrs
+	return nil
+}
+
+func parseTagFields() error {
+	exportSettings.TagFields = nil
+	if writeTags == "" {
+		return nil
+	}
+	if exportSettings.CopyType == COPY_NONE {
+		return errors.New("-writeTags requires -copy, as tags are only written to copied files")
+	}
+
+	for _, field := range strings.Split(writeTags, ",") {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if field == "all" {
+			exportSettings.TagFields = TagFields
+			return nil
+		}
+		known := false
+		for _, tagField := range TagFields {
+			if field == tagField {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return errors.New("Unknown Tag Field: " + field)
+		}
+		exportSettings.TagFields = append(exportSettings.TagFields, field)
+	}
+	return nil
+}
+
 func parsePlaylists(library *Library) []Playlist {
 	var playlists []Playlist
 
 	if includeAllPlaylists {
 		for _, playlist := range library.Playlists {
-			if playlist.DistinguishedKind == 0 && playlist.Name != "Library" {
+			if playlist.IncludedByIncludeAll() {
 				playlists = append(playlists, playlist)
 			}
 		}
 	} else if includeAllWithBuiltinPlaylists {
 		playlists = library.Playlists
-	} else if len(includePlaylistWithRegex) > 0 {
-		for _, playlist := range library.Playlists {
-			match, _ := regexp.MatchString(includePlaylistWithRegex, playlist.Name)
-			if match {
-				playlists = append(playlists, playlist)
-			}
-		}
-	} else if len(includePlaylistNames) > 0 {
-		for _, playlistName := range includePlaylistNames {
-			playlist, ok := library.PlaylistMap[playlistName]
-			if ok {
-				playlists = append(playlists, playlist)
-			} else {
-				fmt.Printf("Unable to find matching playlist for name: %q. Skipping Playlist.\n", playlistName)
-			}
-		}
 	}
 
-	var filteredPlaylists []Playlist
-	for _, playlist := range playlists {
-		remove := false
-		for _, removePlaylistName := range excludePlaylistNames {
-			if playlist.Name == removePlaylistName {
-				remove = true
-				break
-			}
-		}
-		if !remove {
-			filteredPlaylists = append(filteredPlaylists, playlist)
-		}
+	includes, excludes, err := playlistSelectors()
+	if err != nil {
+		fmt.Println(err)
+		return nil
 	}
+	return selectPlaylists(library, playlists, includes, excludes)
+}
 
-	return filteredPlaylists
-
+// playlistSelectors parses the include and exclude parameters and -includePlaylistWithRegex.
+func playlistSelectors() ([]playlistSelector, []playlistSelector, error) {
+	includeTexts := includePlaylistNames
+	if len(includePlaylistWithRegex) > 0 {
+		includeTexts = append([]string{RegexSelectorPrefix + includePlaylistWithRegex}, includeTexts...)
+	}
+	includes, err := parsePlaylistSelectors(includeTexts, ignoreCase)
+	if err != nil {
+		return nil, nil, err
+	}
+	excludes, err := parsePlaylistSelectors(excludePlaylistNames, ignoreCase)
+	if err != nil {
+		return nil, nil, err
+	}
+	return includes, excludes, nil
 }
@@ -169,3 +169,33 @@ func buildStringOnSingleLineRegex(s string) *regexp.Regexp {
 	pattern := "\r?\n" + regexp.QuoteMeta(s) + "\r?\n"
 	return regexp.MustCompile(pattern)
 }
+
+func TestExportPlaylistsWithRockboxProfile(t *testing.T) {
+	// arrange
+	outputDir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(outputDir)
+
+	musicFile, musicFileName := prepareMusicFile(t)
+	defer os.Remove(musicFile)
+
+	itunesDbFile := prepareItunesDbFile(t, filepath.ToSlash(musicFile))
+	defer os.Remove(itunesDbFile)
+
+	// act
+	realArgs := os.Args
+	defer func() { os.Args = realArgs }()
+
+	os.Args = []string{
+		"itunesexport",
+		"-library", itunesDbFile,
+		"-output", outputDir,
+		"-includeAll",
+		"-copy", "PLAYLIST",
+		"-profile", "rockbox",
+	}
+	main()
+
+	// assert
+	expectedPlaylistFilePath := filepath.Join(outputDir, "My Playlist.m3u8")
+	assertPlaylistFileCorrectlyWritten(t, expectedPlaylistFilePath, "My Playlist/"+musicFileName)
+}
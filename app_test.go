@@ -1,6 +1,7 @@
 package main
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -108,8 +109,59 @@ func TestExcludePlaylists(t *testing.T) {
 	}
 }
 
+func TestIncludeAndExcludeFolders(t *testing.T) {
+	resetGlobalVars()
+
+	library := &Library{
+		Playlists: []Playlist{
+			{Name: "Workouts", PlaylistPersistentId: "F1", Folder: true},
+			{Name: "Run", PlaylistPersistentId: "P1", ParentPersistentId: "F1"},
+			{Name: "Archive", PlaylistPersistentId: "F2", Folder: true},
+			{Name: "2019", PlaylistPersistentId: "F3", ParentPersistentId: "F2", Folder: true},
+			{Name: "Summer", PlaylistPersistentId: "P2", ParentPersistentId: "F3"},
+			{Name: "2020", PlaylistPersistentId: "F4", ParentPersistentId: "F2", Folder: true},
+			{Name: "Winter", PlaylistPersistentId: "P3", ParentPersistentId: "F4"},
+			{Name: "Loose", PlaylistPersistentId: "P4"},
+		},
+	}
+	library.PlaylistMap = make(map[string]Playlist)
+	library.PlaylistIdMap = make(map[string]Playlist)
+	for _, playlist := range library.Playlists {
+		library.PlaylistMap[playlist.Name] = playlist
+		library.PlaylistIdMap[playlist.PlaylistPersistentId] = playlist
+	}
+
+	tests := []struct {
+		include  []string
+		exclude  []string
+		expected []string
+	}{
+		{[]string{`folder:"Workouts"`}, nil, []string{"Workouts", "Run"}},
+		{[]string{"folder:Archive"}, nil, []string{"Archive", "2019", "Summer", "2020", "Winter"}},
+		{[]string{"folder:Archive"}, []string{`folder:"Archive/2019"`}, []string{"Archive", "2020", "Winter"}},
+		{[]string{"Archive", "Winter"}, []string{"2020"}, []string{"Archive", "2019", "Summer"}},
+		{[]string{"Run", "folder:Workouts", "Loose"}, nil, []string{"Run", "Workouts", "Loose"}},
+		{[]string{"folder:Missing"}, nil, nil},
+	}
+	for _, test := range tests {
+		resetGlobalVars()
+		includePlaylistNames = test.include
+		excludePlaylistNames = test.exclude
+		var names []string
+		for _, playlist := range parsePlaylists(library) {
+			names = append(names, playlist.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(test.expected, ",") {
+			t.Errorf("include %v exclude %v: expected %v, got %v", test.include, test.exclude, test.expected, names)
+		}
+	}
+}
+
 func resetGlobalVars() {
 	includeAllPlaylists = false
 	includeAllWithBuiltinPlaylists = false
+	includePlaylistWithRegex = ""
+	ignoreCase = false
 	includePlaylistNames = []string{}
+	excludePlaylistNames = []string{}
 }
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dhowden/tag"
+)
+
+// extractArtwork reads the cover art embedded in the music file at src (ID3 APIC, MP4 covr or FLAC PICTURE)
+// and writes it as each of the coverArtFileNames into albumDir. If size is greater than zero the artwork is
+// scaled down so that neither side is larger than size pixels. The files get mode, or 0666 less the umask
+// if mode is zero. Existing cover art files are left untouched.
+func extractArtwork(src string, albumDir string, size int, mode os.FileMode) error {
+	var missing []string
+	for _, name := range coverArtFileNames {
+		if _, err := os.Stat(filepath.Join(albumDir, name)); os.IsNotExist(err) {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	in, err := os.Open(sourceFilePath(src))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	metadata, err := tag.ReadFrom(in)
+	if err != nil {
+		return err
+	}
+	picture := metadata.Picture()
+	if picture == nil || len(picture.Data) == 0 {
+		return nil
+	}
+
+	data, err := artworkJpeg(picture, size)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range missing {
+		err = os.WriteFile(filepath.Join(albumDir, name), data, 0666)
+		if err == nil && mode != 0 {
+			err = os.Chmod(filepath.Join(albumDir, name), mode)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// artworkJpeg returns the picture as JPEG data, re-encoding it only when it is not already a JPEG
+// or when it has to be scaled down to size.
+func artworkJpeg(picture *tag.Picture, size int) ([]byte, error) {
+	isJpeg := strings.EqualFold(picture.Ext, "jpg") || strings.EqualFold(picture.MIMEType, "image/jpeg")
+
+	if isJpeg && size <= 0 {
+		return picture.Data, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(picture.Data))
+	if err != nil {
+		return nil, err
+	}
+	if size > 0 {
+		img = scaleImage(img, size)
+	}
+
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// scaleImage scales img down, preserving the aspect ratio, so that neither side exceeds maxSize.
+// Each destination pixel is the average of the source pixels it covers. Images that already fit are returned as is.
+func scaleImage(img image.Image, maxSize int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxSize && height <= maxSize {
+		return img
+	}
+
+	newWidth, newHeight := maxSize, maxSize
+	if width > height {
+		newHeight = atLeastOne(height * maxSize / width)
+	} else {
+		newWidth = atLeastOne(width * maxSize / height)
+	}
+
+	scaled := image.NewRGBA(image.Rect(0, 0, newWidth, newHeight))
+	for y := 0; y < newHeight; y++ {
+		y0 := bounds.Min.Y + y*height/newHeight
+		y1 := y0 + atLeastOne(bounds.Min.Y+(y+1)*height/newHeight-y0)
+		for x := 0; x < newWidth; x++ {
+			x0 := bounds.Min.X + x*width/newWidth
+			x1 := x0 + atLeastOne(bounds.Min.X+(x+1)*width/newWidth-x0)
+
+			var r, g, b, a, count uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					count++
+				}
+			}
+			scaled.Set(x, y, color.RGBA64{
+				R: uint16(r / count),
+				G: uint16(g / count),
+				B: uint16(b / count),
+				A: uint16(a / count),
+			})
+		}
+	}
+	return scaled
+}
+
+func atLeastOne(n int) int {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
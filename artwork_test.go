@@ -0,0 +1,33 @@
+package main
+
+import (
+	"image"
+	"testing"
+
+	"github.com/dhowden/tag"
+)
+
+func TestScaleImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 1000, 500))
+
+	scaled := scaleImage(img, 300)
+	if scaled.Bounds().Dx() != 300 || scaled.Bounds().Dy() != 150 {
+		t.Errorf("expected 300x150, got %vx%v", scaled.Bounds().Dx(), scaled.Bounds().Dy())
+	}
+
+	if scaleImage(img, 2000) != image.Image(img) {
+		t.Error("expected images that fit to be returned unchanged")
+	}
+}
+
+func TestArtworkJpegPassesThroughJpeg(t *testing.T) {
+	picture := &tag.Picture{Ext: "jpg", MIMEType: "image/jpeg", Data: []byte(FileContent)}
+
+	data, err := artworkJpeg(picture, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != FileContent {
+		t.Error("expected jpeg artwork to be written unchanged")
+	}
+}
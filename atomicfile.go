@@ -0,0 +1,80 @@
+package main
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// atomicFile is written to a hidden temporary file next to its destination, which is only renamed into
+// place by Commit. Media servers watching the output folder therefore never see a half-written file, and
+// an existing file is left untouched if the export fails.
+type atomicFile struct {
+	*os.File
+	dest string
+	mode os.FileMode
+	done bool
+}
+
+// createAtomicFile creates the temporary file for dest, which gets mode when it is committed. If mode is
+// zero, the file gets the permissions of any newly created file, 0666 less the umask. The temporary file
+// ends in .tmp, so media scanners and sync tools do not pick up a half-written file.
+func createAtomicFile(dest string, mode os.FileMode) (*atomicFile, error) {
+	tmp, err := newTempFile(filepath.Dir(dest), "."+filepath.Base(dest)+".", ".tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &atomicFile{File: tmp, dest: dest, mode: mode}, nil
+}
+
+// newTempFile creates a new file in dir named prefix, a random number and suffix. Unlike os.CreateTemp,
+// which always uses mode 0600, the file is created with mode 0666 less the umask.
+func newTempFile(dir string, prefix string, suffix string) (*os.File, error) {
+	for i := 0; i < 10000; i++ {
+		name := filepath.Join(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 10)+suffix)
+		file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if !os.IsExist(err) {
+			return file, err
+		}
+	}
+	return nil, &os.PathError{Op: "createtemp", Path: filepath.Join(dir, prefix+"*"+suffix), Err: os.ErrExist}
+}
+
+// Commit flushes and closes the temporary file and renames it to its destination. If prepare is not nil,
+// it is called with the path of the closed temporary file before the rename, e.g. to write tags.
+func (f *atomicFile) Commit(prepare func(string) error) error {
+	if f.done {
+		return os.ErrClosed
+	}
+	f.done = true
+	err := f.Sync()
+	if closeErr := f.File.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && prepare != nil {
+		err = prepare(f.Name())
+	}
+	if err == nil && f.mode != 0 {
+		// By path, because prepare may have replaced the file.
+		err = os.Chmod(f.Name(), f.mode)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), f.dest)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// Abort closes and removes the temporary file, leaving the destination untouched.
+// It does nothing once the file has been committed, so it can be deferred.
+func (f *atomicFile) Abort() {
+	if f.done {
+		return
+	}
+	f.done = true
+	f.File.Close()
+	os.Remove(f.Name())
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAtomicFileCommit(t *testing.T) {
+	outputDir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(outputDir)
+	dest := filepath.Join(outputDir, "Mix.m3u")
+	writeFile(t, dest, "old")
+
+	file, err := createAtomicFile(dest, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(file.Name(), ".tmp") {
+		t.Errorf("expected the temporary file to end in .tmp, got %v", file.Name())
+	}
+	file.WriteString("new")
+	if readFile(t, dest) != "old" {
+		t.Error("expected the destination to be unchanged before Commit")
+	}
+	if err = file.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	file.Abort()
+
+	if readFile(t, dest) != "new" {
+		t.Error("expected the destination to be replaced by Commit")
+	}
+	assertDirEntries(t, outputDir, "Mix.m3u")
+}
+
+func TestAtomicFileModeRespectsUmask(t *testing.T) {
+	outputDir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(outputDir)
+
+	// A file created the usual way gets 0666 less the umask.
+	created, err := os.Create(filepath.Join(outputDir, "reference"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	created.Close()
+	reference, err := os.Stat(created.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dest := filepath.Join(outputDir, "Mix.m3u")
+	file, err := createAtomicFile(dest, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = file.Commit(nil); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != reference.Mode().Perm() {
+		t.Errorf("expected file mode %v, got %v", reference.Mode().Perm(), info.Mode().Perm())
+	}
+}
+
+func TestExportPlaylistsLeavesExistingPlaylistOnError(t *testing.T) {
+	outputDir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(outputDir)
+	playlistFile := filepath.Join(outputDir, "Mix.m3u")
+	writeFile(t, playlistFile, "marker")
+
+	library := &Library{
+		Tracks: map[string]Track{"1": {TrackId: 1, Name: "Song", Location: "file:///music/song.mp3"}},
+	}
+	exportSettings := &ExportSettings{
+		Library:       library,
+		Playlists:     []Playlist{{Name: "Mix", PlaylistItems: []PlaylistItem{{TrackId: 1}}}},
+		ExportType:    -1,
+		Extension:     "m3u",
+		OutputPath:    outputDir,
+		PathSeparator: "/",
+	}
+	if err := ExportPlaylists(context.Background(), exportSettings, library); err == nil {
+		t.Fatal("expected an error for an unknown export type")
+	}
+
+	if readFile(t, playlistFile) != "marker" {
+		t.Error("expected the existing playlist to be left untouched")
+	}
+	assertDirEntries(t, outputDir, "Mix.m3u")
+}
+
+func TestCopyFileDataRemovesPartialCopy(t *testing.T) {
+	outputDir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(outputDir)
+	src := filepath.Join(outputDir, "song.mp3")
+	writeFile(t, src, FileContent)
+
+	copiesDir := filepath.Join(outputDir, "copies")
+	os.Mkdir(copiesDir, 0777)
+	err := copyFileData(context.Background(), src, filepath.Join(copiesDir, "song.mp3"), copyOptions{prepare: func(string) error { return os.ErrInvalid }})
+	if err != os.ErrInvalid {
+		t.Fatalf("expected the error of prepare, got %v", err)
+	}
+	assertDirEntries(t, copiesDir)
+}
+
+func assertDirEntries(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []string
+	for _, entry := range entries {
+		found = append(found, entry.Name())
+	}
+	if len(found) != len(names) {
+		t.Fatalf("expected %v in %v, found %v", names, dir, found)
+	}
+	for i := range names {
+		if found[i] != names[i] {
+			t.Fatalf("expected %v in %v, found %v", names, dir, found)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// A command is run in place of the playlist export when its name is the first argument,
+// e.g. itunesexport stats -format json
+type command struct {
+	name string
+	run  func(args []string) error
+}
+
+var commands = []command{
+	{"stats", statsCommand},
+	{"tracks", tracksCommand},
+	{"dump", dumpCommand},
+	{"export-sqlite", exportSqliteCommand},
+	{"diff", diffCommand},
+	{"verify", verifyCommand},
+	{"list", listCommand},
+}
+
+// runCommand runs the command named by the first argument. It returns false if there is no such command.
+// If the command fails, e.g. verify finds a problem, the error is printed and the process exits with status 1.
+func runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			if err := cmd.run(args[1:]); err != nil {
+				fmt.Fprintf(os.Stderr, "%v: %v\n", cmd.name, err)
+				os.Exit(1)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// newCommandFlags returns a flag set for a command, with the -library flag all commands share.
+func newCommandFlags(name string, libraryPath *string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.StringVar(libraryPath, "library", "", "")
+	return flags
+}
+
+// parseCommandArgs parses the flags of a command, which may appear before, between or after its
+// positional arguments, and returns the positional arguments.
+func parseCommandArgs(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+}
+
+// loadCommandLibrary loads the library at path, or from the default location if path is empty.
+func loadCommandLibrary(path string) (*Library, error) {
+	if path == "" {
+		var err error
+		path, err = defaultLibraryPath()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return LoadLibrary(filepath.Clean(path))
+}
+
+// commandOutput returns the file at path for writing, or stdout if path is empty.
+// The returned function closes the file and must always be called.
+func commandOutput(path string) (io.Writer, func() error, error) {
+	if path == "" {
+		return os.Stdout, func() error { return nil }, nil
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, file.Close, nil
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LibraryDiff lists the changes between two snapshots of a library. Tracks and playlists are matched
+// by persistent ID, so renamed tracks and playlists are reported as changes rather than as additions.
+type LibraryDiff struct {
+	TracksAdded       []DiffTrack        `json:"tracksAdded"`
+	TracksRemoved     []DiffTrack        `json:"tracksRemoved"`
+	TracksChanged     []TrackChange      `json:"tracksChanged"`
+	TracksMoved       []TrackMove        `json:"tracksMoved"`
+	PlaylistsCreated  []DiffPlaylist     `json:"playlistsCreated"`
+	PlaylistsDeleted  []DiffPlaylist     `json:"playlistsDeleted"`
+	PlaylistsRenamed  []PlaylistRename   `json:"playlistsRenamed"`
+	MembershipChanges []MembershipChange `json:"membershipChanges"`
+}
+
+// DiffTrack identifies a track in a LibraryDiff.
+type DiffTrack struct {
+	PersistentId string `json:"persistentId"`
+	Name         string `json:"name"`
+	Artist       string `json:"artist,omitempty"`
+}
+
+// TrackChange lists the fields of a track that changed.
+type TrackChange struct {
+	DiffTrack
+	Changes []FieldChange `json:"changes"`
+}
+
+// FieldChange is the old and new value of a single track field.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// TrackMove is a track whose file location changed.
+type TrackMove struct {
+	DiffTrack
+	OldLocation string `json:"oldLocation"`
+	NewLocation string `json:"newLocation"`
+}
+
+// DiffPlaylist identifies a playlist in a LibraryDiff.
+type DiffPlaylist struct {
+	PersistentId string `json:"persistentId"`
+	Name         string `json:"name"`
+	Folder       bool   `json:"folder,omitempty"`
+}
+
+// PlaylistRename is a playlist whose name changed.
+type PlaylistRename struct {
+	PersistentId string `json:"persistentId"`
+	OldName      string `json:"oldName"`
+	NewName      string `json:"newName"`
+}
+
+// MembershipChange lists the tracks added to and removed from a playlist.
+type MembershipChange struct {
+	DiffPlaylist
+	Added   []DiffTrack `json:"added"`
+	Removed []DiffTrack `json:"removed"`
+}
+
+// Track fields that are not compared, because they are reported separately or follow from the location.
+var diffIgnoredFields = map[string]bool{
+	"TrackId": true, "PersistentId": true, "Location": true, "FileFolderCount": true, "LibraryFolderCount": true,
+}
+
+// Track fields that change with every play, only compared with -plays.
+var diffPlayFields = map[string]bool{
+	"PlayCount": true, "PlayDate": true, "PlayDateUTC": true, "SkipCount": true, "SkipDate": true,
+}
+
+func diffCommand(args []string) error {
+	var format, output string
+	var plays bool
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.StringVar(&format, "format", "text", "")
+	flags.StringVar(&output, "output", "", "")
+	flags.BoolVar(&plays, "plays", false, "")
+	positional, err := parseCommandArgs(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return errors.New("usage: diff [-format text|json] [-plays] [-output <file path>] <old library> <new library>")
+	}
+	format = strings.ToLower(format)
+	if format != "text" && format != "json" {
+		return errors.New("Unknown Format: " + format)
+	}
+
+	oldLibrary, err := LoadLibrary(positional[0])
+	if err != nil {
+		return err
+	}
+	newLibrary, err := LoadLibrary(positional[1])
+	if err != nil {
+		return err
+	}
+	diff := diffLibraries(oldLibrary, newLibrary, plays)
+
+	w, closeOutput, err := commandOutput(output)
+	if err != nil {
+		return err
+	}
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(diff)
+	} else {
+		err = writeDiffText(w, diff)
+	}
+	if closeErr := closeOutput(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// diffLibraries compares two snapshots of a library. Play and skip statistics are only compared if plays is set.
+func diffLibraries(oldLibrary *Library, newLibrary *Library, plays bool) *LibraryDiff {
+	diff := &LibraryDiff{}
+	oldTracks := tracksByPersistentId(oldLibrary)
+	newTracks := tracksByPersistentId(newLibrary)
+
+	for _, persistentId := range sortedKeys(newTracks) {
+		newTrack := newTracks[persistentId]
+		oldTrack, ok := oldTracks[persistentId]
+		if !ok {
+			diff.TracksAdded = append(diff.TracksAdded, newDiffTrack(newTrack))
+			continue
+		}
+
+		if changes := diffTrackFields(oldTrack, newTrack, plays); len(changes) > 0 {
+			diff.TracksChanged = append(diff.TracksChanged, TrackChange{newDiffTrack(newTrack), changes})
+		}
+		if oldTrack.Location != newTrack.Location {
+			diff.TracksMoved = append(diff.TracksMoved, TrackMove{newDiffTrack(newTrack), oldTrack.Location, newTrack.Location})
+		}
+	}
+	for _, persistentId := range sortedKeys(oldTracks) {
+		if _, ok := newTracks[persistentId]; !ok {
+			diff.TracksRemoved = append(diff.TracksRemoved, newDiffTrack(oldTracks[persistentId]))
+		}
+	}
+
+	for _, newPlaylist := range newLibrary.Playlists {
+		oldPlaylist, ok := playlistByPersistentId(oldLibrary, newPlaylist.PlaylistPersistentId)
+		if !ok {
+			diff.PlaylistsCreated = append(diff.PlaylistsCreated, newDiffPlaylist(newPlaylist))
+			continue
+		}
+		if oldPlaylist.Name != newPlaylist.Name {
+			diff.PlaylistsRenamed = append(diff.PlaylistsRenamed,
+				PlaylistRename{newPlaylist.PlaylistPersistentId, oldPlaylist.Name, newPlaylist.Name})
+		}
+		if newPlaylist.Folder {
+			continue
+		}
+
+		change := MembershipChange{DiffPlaylist: newDiffPlaylist(newPlaylist)}
+		oldMembers := playlistMembers(&oldPlaylist, oldLibrary)
+		newMembers := playlistMembers(&newPlaylist, newLibrary)
+		for _, persistentId := range sortedKeys(newMembers) {
+			if _, ok := oldMembers[persistentId]; !ok {
+				change.Added = append(change.Added, newDiffTrack(newMembers[persistentId]))
+			}
+		}
+		for _, persistentId := range sortedKeys(oldMembers) {
+			if _, ok := newMembers[persistentId]; !ok {
+				change.Removed = append(change.Removed, newDiffTrack(oldMembers[persistentId]))
+			}
+		}
+		if len(change.Added) > 0 || len(change.Removed) > 0 {
+			diff.MembershipChanges = append(diff.MembershipChanges, change)
+		}
+	}
+	for _, oldPlaylist := range oldLibrary.Playlists {
+		if _, ok := playlistByPersistentId(newLibrary, oldPlaylist.PlaylistPersistentId); !ok {
+			diff.PlaylistsDeleted = append(diff.PlaylistsDeleted, newDiffPlaylist(oldPlaylist))
+		}
+	}
+
+	return diff
+}
+
+// diffTrackFields compares every field of the Track struct, except diffIgnoredFields and, unless plays is set,
+// diffPlayFields. Fields are named in lower case, e.g. bitrate or loved, and dates are formatted as RFC 3339.
+func diffTrackFields(oldTrack Track, newTrack Track, plays bool) []FieldChange {
+	var changes []FieldChange
+	oldValue, newValue := reflect.ValueOf(oldTrack), reflect.ValueOf(newTrack)
+	for i := 0; i < oldValue.NumField(); i++ {
+		name := oldValue.Type().Field(i).Name
+		if diffIgnoredFields[name] || (!plays && diffPlayFields[name]) {
+			continue
+		}
+		oldText, newText := diffFieldValue(oldValue.Field(i)), diffFieldValue(newValue.Field(i))
+		if oldText != newText {
+			changes = append(changes, FieldChange{strings.ToLower(name), oldText, newText})
+		}
+	}
+	return changes
+}
+
+func diffFieldValue(value reflect.Value) string {
+	if date, ok := value.Interface().(time.Time); ok {
+		return formatDate(date)
+	}
+	return fmt.Sprint(value.Interface())
+}
+
+func tracksByPersistentId(library *Library) map[string]Track {
+	tracks := make(map[string]Track, len(library.Tracks))
+	for _, track := range library.Tracks {
+		tracks[track.PersistentId] = track
+	}
+	return tracks
+}
+
+func playlistByPersistentId(library *Library, persistentId string) (Playlist, bool) {
+	if library.PlaylistIdMap != nil {
+		playlist, ok := library.PlaylistIdMap[persistentId]
+		return playlist, ok
+	}
+	for _, playlist := range library.Playlists {
+		if playlist.PlaylistPersistentId == persistentId {
+			return playlist, true
+		}
+	}
+	return Playlist{}, false
+}
+
+func playlistMembers(playlist *Playlist, library *Library) map[string]Track {
+	members := make(map[string]Track)
+	for _, track := range playlist.Tracks(library) {
+		members[track.PersistentId] = track
+	}
+	return members
+}
+
+func sortedKeys(tracks map[string]Track) []string {
+	keys := make([]string, 0, len(tracks))
+	for key := range tracks {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func newDiffTrack(track Track) DiffTrack {
+	return DiffTrack{track.PersistentId, track.Name, track.Artist}
+}
+
+func newDiffPlaylist(playlist Playlist) DiffPlaylist {
+	return DiffPlaylist{playlist.PlaylistPersistentId, playlist.Name, playlist.Folder}
+}
+
+func (t DiffTrack) String() string {
+	if t.Artist == "" {
+		return fmt.Sprintf("%v [%v]", t.Name, t.PersistentId)
+	}
+	return fmt.Sprintf("%v - %v [%v]", t.Artist, t.Name, t.PersistentId)
+}
+
+func (p DiffPlaylist) String() string {
+	if p.Folder {
+		return fmt.Sprintf("%v (folder) [%v]", p.Name, p.PersistentId)
+	}
+	return fmt.Sprintf("%v [%v]", p.Name, p.PersistentId)
+}
+
+func writeDiffText(w io.Writer, diff *LibraryDiff) error {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "Tracks added: %v\n", len(diff.TracksAdded))
+	for _, track := range diff.TracksAdded {
+		fmt.Fprintf(b, "  + %v\n", track)
+	}
+	fmt.Fprintf(b, "Tracks removed: %v\n", len(diff.TracksRemoved))
+	for _, track := range diff.TracksRemoved {
+		fmt.Fprintf(b, "  - %v\n", track)
+	}
+	fmt.Fprintf(b, "Tracks changed: %v\n", len(diff.TracksChanged))
+	for _, change := range diff.TracksChanged {
+		fmt.Fprintf(b, "  * %v\n", change.DiffTrack)
+		for _, field := range change.Changes {
+			fmt.Fprintf(b, "      %v: %q -> %q\n", field.Field, field.Old, field.New)
+		}
+	}
+	fmt.Fprintf(b, "Tracks moved: %v\n", len(diff.TracksMoved))
+	for _, move := range diff.TracksMoved {
+		fmt.Fprintf(b, "  > %v\n      %v\n   -> %v\n", move.DiffTrack, move.OldLocation, move.NewLocation)
+	}
+	fmt.Fprintf(b, "Playlists created: %v\n", len(diff.PlaylistsCreated))
+	for _, playlist := range diff.PlaylistsCreated {
+		fmt.Fprintf(b, "  + %v\n", playlist)
+	}
+	fmt.Fprintf(b, "Playlists deleted: %v\n", len(diff.PlaylistsDeleted))
+	for _, playlist := range diff.PlaylistsDeleted {
+		fmt.Fprintf(b, "  - %v\n", playlist)
+	}
+	fmt.Fprintf(b, "Playlists renamed: %v\n", len(diff.PlaylistsRenamed))
+	for _, rename := range diff.PlaylistsRenamed {
+		fmt.Fprintf(b, "  * %q -> %q [%v]\n", rename.OldName, rename.NewName, rename.PersistentId)
+	}
+	fmt.Fprintf(b, "Playlist membership changes: %v\n", len(diff.MembershipChanges))
+	for _, change := range diff.MembershipChanges {
+		fmt.Fprintf(b, "  * %v\n", change.DiffPlaylist)
+		for _, track := range change.Added {
+			fmt.Fprintf(b, "      + %v\n", track)
+		}
+		for _, track := range change.Removed {
+			fmt.Fprintf(b, "      - %v\n", track)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiffLibraries(t *testing.T) {
+	oldLibrary := &Library{
+		Tracks: map[string]Track{
+			"1": {TrackId: 1, PersistentId: "AAA", Name: "Kept", Location: "file:///a.mp3", PlayCount: 1},
+			"2": {TrackId: 2, PersistentId: "BBB", Name: "Removed"},
+		},
+		Playlists: []Playlist{
+			{Name: "Mix", PlaylistPersistentId: "P1", PlaylistItems: []PlaylistItem{{TrackId: 1}, {TrackId: 2}}},
+			{Name: "Old", PlaylistPersistentId: "P2"},
+		},
+	}
+	newLibrary := &Library{
+		Tracks: map[string]Track{
+			"1": {TrackId: 1, PersistentId: "AAA", Name: "Renamed", Location: "file:///b.mp3", PlayCount: 5, Loved: true},
+			"3": {TrackId: 3, PersistentId: "CCC", Name: "Added"},
+		},
+		Playlists: []Playlist{
+			{Name: "Mix 2", PlaylistPersistentId: "P1", PlaylistItems: []PlaylistItem{{TrackId: 1}, {TrackId: 3}}},
+			{Name: "New", PlaylistPersistentId: "P3"},
+		},
+	}
+
+	diff := diffLibraries(oldLibrary, newLibrary, false)
+
+	if len(diff.TracksAdded) != 1 || diff.TracksAdded[0].PersistentId != "CCC" {
+		t.Errorf("unexpected added tracks: %v", diff.TracksAdded)
+	}
+	if len(diff.TracksRemoved) != 1 || diff.TracksRemoved[0].PersistentId != "BBB" {
+		t.Errorf("unexpected removed tracks: %v", diff.TracksRemoved)
+	}
+	if len(diff.TracksChanged) != 1 || len(diff.TracksChanged[0].Changes) != 2 ||
+		diff.TracksChanged[0].Changes[0] != (FieldChange{"name", "Kept", "Renamed"}) ||
+		diff.TracksChanged[0].Changes[1] != (FieldChange{"loved", "false", "true"}) {
+		t.Errorf("unexpected changed tracks: %v", diff.TracksChanged)
+	}
+	if len(diff.TracksMoved) != 1 || diff.TracksMoved[0].NewLocation != "file:///b.mp3" {
+		t.Errorf("unexpected moved tracks: %v", diff.TracksMoved)
+	}
+	if len(diff.PlaylistsCreated) != 1 || len(diff.PlaylistsDeleted) != 1 || len(diff.PlaylistsRenamed) != 1 {
+		t.Errorf("unexpected playlist changes: %+v", diff)
+	}
+	if len(diff.MembershipChanges) != 1 || len(diff.MembershipChanges[0].Added) != 1 || len(diff.MembershipChanges[0].Removed) != 1 {
+		t.Errorf("unexpected membership changes: %v", diff.MembershipChanges)
+	}
+
+	withPlays := diffLibraries(oldLibrary, newLibrary, true)
+	if len(withPlays.TracksChanged[0].Changes) != 3 {
+		t.Errorf("expected play count change to be reported: %v", withPlays.TracksChanged)
+	}
+}
+
+func TestDiffCommandUnknownFormatLeavesOutput(t *testing.T) {
+	dir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "diff.txt")
+	writeFile(t, output, "previous")
+
+	err := diffCommand([]string{"-format", "xml", "-output", output, "old.xml", "new.xml"})
+	if err == nil || err.Error() != "Unknown Format: xml" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if readFile(t, output) != "previous" {
+		t.Error("expected the output file to be left untouched")
+	}
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
-	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -16,6 +19,8 @@ const (
 	EXT
 	WPL
 	ZPL
+	CSV
+	TSV
 )
 
 const (
@@ -26,7 +31,10 @@ const (
 )
 
 type playlistWriter func(io.Writer, *ExportSettings, *Playlist) error
-type trackWriter func(io.Writer, *ExportSettings, *Playlist, *Track, string) error
+
+// trackWriter writes the entry of a track, given its formatted location and the formatted location of
+// its cover art, which is empty unless the export type writes extended directives.
+type trackWriter func(io.Writer, *ExportSettings, *Playlist, *Track, string, string) error
 
 type ExportSettings struct {
 	Library           *Library
@@ -37,18 +45,54 @@ type ExportSettings struct {
 	CopyType          int
 	OriginalMusicPath string
 	NewMusicPath      string
+	RewriteRules      rewriteRules
 	PathSeparator     string
+	ExtDirectives     bool
+	Artwork           bool
+	ArtworkSize       int
+	TagFields         []string
+	RelativePaths     bool
+	Columns           []trackColumn
+	// PlaylistStates records each playlist as it was last exported, keyed by playlistKey. Playlists with an
+	// unchanged hash are skipped, and the files of playlists that are no longer exported are removed.
+	// If nil, every playlist is exported.
+	PlaylistStates map[string]PlaylistState
+	// Journal records the progress of the export. If not nil, playlists it already records are skipped.
+	Journal *Journal
+	// Manifest records the checksums of the copied files. If not nil, every copy is verified.
+	Manifest *Manifest
+	// LinkMode is one of the LINK_ constants, selecting whether tracks are copied or linked.
+	LinkMode int
+	// FileMode and DirMode are the permissions of the files and folders written. Zero leaves them to the umask.
+	FileMode os.FileMode
+	DirMode  os.FileMode
+	// ModTime is one of the MTIME_ constants, selecting the modification time of copied tracks.
+	ModTime int
+	// Xattrs selects whether the extended attributes of tracks are copied.
+	Xattrs bool
+	// TargetOS is one of the OS_ constants. It only selects the default path separator and the origin warning.
+	TargetOS string
+	// ExportFolders selects whether folders are exported as playlists of the tracks inside them.
+	ExportFolders bool
 }
 
-func ExportPlaylists(exportSettings *ExportSettings, library *Library) error {
+// ExportPlaylists exports the playlists of the exportSettings. If ctx is cancelled, the playlist and track
+// being written are rolled back and the context error is returned.
+func ExportPlaylists(ctx context.Context, exportSettings *ExportSettings, library *Library) error {
 	start := time.Now()
+	exported := make(map[string]bool)
 
 	for _, playlist := range exportSettings.Playlists {
-		// Skip Folders
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		if playlist.Folder {
-			continue
+			if !exportSettings.ExportFolders {
+				continue
+			}
+			playlist = mergeFolder(playlist, library)
 		}
-		fmt.Printf("Exporting Playlist %v\n", playlist.Name)
 
 		filePath := ""
 		if includeFolders && playlist.ParentPersistentId != "" {
@@ -56,88 +100,221 @@ func ExportPlaylists(exportSettings *ExportSettings, library *Library) error {
 		}
 
 		if filePath != "" {
-			os.MkdirAll(filepath.Join(exportSettings.OutputPath, filePath), 0777)
+			makeDirs(filepath.Join(exportSettings.OutputPath, filePath), exportSettings.DirMode)
 		}
 
-		fileName := filepath.Join(exportSettings.OutputPath, filePath, playlist.SafeName()+"."+exportSettings.Extension)
-
-		file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
-		if err != nil {
-			return err
-		}
-		defer file.Close()
-
-		var header playlistWriter
-		var entry trackWriter
-		var footer playlistWriter
-		switch exportSettings.ExportType {
-		case M3U:
-			header, entry, footer = m3uPlaylistWriters()
-		case EXT:
-			header, entry, footer = extPlaylistWriters()
-		case WPL:
-			header, entry, footer = wplPlaylistWriters()
-		case ZPL:
-			header, entry, footer = zplPlaylistWriters()
-		default:
-			return errors.New("export type not implemented")
-		}
-
-		// Write out the Header
-		err = header(file, exportSettings, &playlist)
-		if err != nil {
-			return err
+		extension := exportSettings.Extension
+		if exportSettings.ExportType == EXT && exportSettings.ExtDirectives && hasNonASCII(&playlist, library) {
+			extension = "m3u8"
 		}
 
-		// Write the body of the playlist
-		for _, track := range playlist.Tracks(exportSettings.Library) {
+		fileName := filepath.Join(exportSettings.OutputPath, filePath, playlist.SafeName()+"."+extension)
 
-			sourceFileLocation, errParse := url.QueryUnescape(track.Location)
-			sourceFileLocation = trimTrackLocationPrefix(sourceFileLocation)
+		// Skip playlists that have not changed since they were last exported, as long as the file is still there.
+		key := playlistKey(&playlist)
+		hash := playlistHash(exportSettings, &playlist, fileName)
+		exported[key] = true
+		previous, hasPrevious := exportSettings.PlaylistStates[key]
+		state := PlaylistState{Name: playlist.Name, File: fileName, Hash: hash}
+		if exportSettings.Journal.Completed(key, hash) {
+			fmt.Printf("Skipping Playlist %v, exported before the interruption\n", playlist.Name)
+		} else {
+			if hasPrevious && previous.Hash == hash {
+				if _, err := os.Stat(fileName); err == nil {
+					fmt.Printf("Skipping unchanged Playlist %v\n", playlist.Name)
+					if exportSettings.Manifest != nil {
+						if err := copyPlaylistTracks(ctx, exportSettings, library, &playlist); err != nil {
+							return err
+						}
+					}
+					continue
+				}
+			}
+			fmt.Printf("Exporting Playlist %v\n", playlist.Name)
 
-			destFileLocation, err := copyTrack(library, exportSettings, &playlist, &track, sourceFileLocation)
+			err := exportPlaylist(ctx, exportSettings, library, &playlist, fileName)
 			if err != nil {
-				fmt.Printf("Unable to copy file %v: %v\n", sourceFileLocation, err.Error())
-				continue
+				return err
+			}
+			err = exportSettings.Journal.Record(key, state)
+			if err != nil {
+				return err
 			}
+		}
 
-			if errParse != nil {
-				fmt.Printf("Skipping Track %v because an error occured parsing the location: %v\n", track.Name, errParse.Error())
-				continue
+		if exportSettings.PlaylistStates != nil {
+			// Remove the previous file if the playlist was renamed or moved.
+			if hasPrevious && previous.File != fileName {
+				os.Remove(previous.File)
 			}
+			exportSettings.PlaylistStates[key] = state
+		}
+	}
 
-			// Replace the default path separator with the one specified.
-			// The XML file always uses / even on Windows, so we don't need to use filepath.Separator here.
-			// here as that would not work correctly on Windows.
-			formattedDest := strings.ReplaceAll(destFileLocation, "/", exportSettings.PathSeparator)
+	if exportSettings.PlaylistStates != nil {
+		removeStalePlaylists(exportSettings.PlaylistStates, exported)
+	}
 
-			err = entry(file, exportSettings, &playlist, &track, formattedDest)
-			if err != nil {
-				return err
+	fmt.Printf("\n\nExport Complete.\n")
+	fmt.Println(time.Since(start).String())
+	return nil
+}
+
+// exportPlaylist writes a single playlist to fileName, copying its tracks as configured.
+// The file is only replaced once the whole playlist has been written.
+func exportPlaylist(ctx context.Context, exportSettings *ExportSettings, library *Library, playlist *Playlist, fileName string) error {
+	header, entry, footer, err := playlistWriters(exportSettings.ExportType)
+	if err != nil {
+		return err
+	}
+
+	file, err := createAtomicFile(fileName, exportSettings.FileMode)
+	if err != nil {
+		return err
+	}
+	defer file.Abort()
+
+	// Write out the Header
+	err = header(file, exportSettings, playlist)
+	if err != nil {
+		return err
+	}
+
+	// Write the body of the playlist
+	for _, track := range playlist.Tracks(exportSettings.Library) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		sourceFileLocation, errParse := locationPath(track.Location)
+
+		destFileLocation, err := copyTrack(ctx, library, exportSettings, playlist, &track, sourceFileLocation)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			fmt.Printf("Unable to copy file %v: %v\n", sourceFileLocation, err.Error())
+			continue
+		}
+
+		if errParse != nil {
+			fmt.Printf("Skipping Track %v because an error occured parsing the location: %v\n", track.Name, errParse.Error())
+			continue
+		}
+
+		// Look for the cover art next to the local file, before the location is rewritten for the playlist.
+		coverArt := ""
+		if exportSettings.ExportType == EXT && exportSettings.ExtDirectives {
+			if exportSettings.CopyType == COPY_NONE {
+				if coverArt = coverArtLocation(sourceFilePath(sourceFileLocation)); coverArt != "" {
+					coverArt, _ = exportSettings.musicPathRules().rewrite(coverArt)
+				}
+			} else {
+				coverArt = coverArtLocation(destFileLocation)
+			}
+			if coverArt != "" {
+				coverArt = formatPlaylistLocation(exportSettings, fileName, coverArt)
 			}
 		}
 
-		// Write the footer.
-		err = footer(file, exportSettings, &playlist)
+		err = entry(file, exportSettings, playlist, &track, formatPlaylistLocation(exportSettings, fileName, destFileLocation), coverArt)
 		if err != nil {
 			return err
 		}
+	}
 
+	// Write the footer.
+	err = footer(file, exportSettings, playlist)
+	if err != nil {
+		return err
 	}
+	return file.Commit(nil)
+}
 
-	fmt.Printf("\n\nExport Complete.\n")
-	fmt.Println(time.Since(start).String())
+// copyPlaylistTracks copies the tracks of a playlist without writing the playlist file. It is used for
+// unchanged playlists with -verify, so their copies are still checked and any corrupt or missing copy is
+// restored.
+func copyPlaylistTracks(ctx context.Context, exportSettings *ExportSettings, library *Library, playlist *Playlist) error {
+	for _, track := range playlist.Tracks(exportSettings.Library) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		sourceFileLocation, _ := locationPath(track.Location)
+		_, err := copyTrack(ctx, library, exportSettings, playlist, &track, sourceFileLocation)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			fmt.Printf("Unable to copy file %v: %v\n", sourceFileLocation, err.Error())
+		}
+	}
 	return nil
 }
 
+// playlistWriters returns the writers for the header, the tracks and the footer of the export type.
+func playlistWriters(exportType int) (playlistWriter, trackWriter, playlistWriter, error) {
+	switch exportType {
+	case M3U:
+		header, entry, footer := m3uPlaylistWriters()
+		return header, entry, footer, nil
+	case EXT:
+		header, entry, footer := extPlaylistWriters()
+		return header, entry, footer, nil
+	case WPL:
+		header, entry, footer := wplPlaylistWriters()
+		return header, entry, footer, nil
+	case ZPL:
+		header, entry, footer := zplPlaylistWriters()
+		return header, entry, footer, nil
+	case CSV:
+		header, entry, footer := csvPlaylistWriters(',')
+		return header, entry, footer, nil
+	case TSV:
+		header, entry, footer := csvPlaylistWriters('\t')
+		return header, entry, footer, nil
+	default:
+		return nil, nil, nil, errors.New("export type not implemented")
+	}
+}
+
+// formatPlaylistLocation formats a location as it is written to the playlist file fileName, relative to it
+// with -pathStyle relative and with the -pathSeparator.
+func formatPlaylistLocation(exportSettings *ExportSettings, fileName string, location string) string {
+	if exportSettings.RelativePaths {
+		location = relativeLocation(filepath.Dir(fileName), location)
+	}
+
+	// Replace the default path separator with the one specified.
+	// The XML file always uses / even on Windows, so we don't need to use filepath.Separator here.
+	// here as that would not work correctly on Windows.
+	return strings.ReplaceAll(location, "/", exportSettings.PathSeparator)
+}
+
+// relativeLocation returns location relative to dir, using / as the separator.
+// The location is returned unchanged if no relative path exists, e.g. on another Windows drive.
+func relativeLocation(dir string, location string) string {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return location
+	}
+	absLocation, err := filepath.Abs(filepath.FromSlash(location))
+	if err != nil {
+		return location
+	}
+	rel, err := filepath.Rel(absDir, absLocation)
+	if err != nil {
+		return location
+	}
+	return filepath.ToSlash(rel)
+}
+
 // copyTrack copies a file from the provided sourceFileLocation to another location. The new location
 // depends on the CopyType selected in exportSettings. If COPY_NONE is selected, the sourceFileLocation is returned.
-func copyTrack(library *Library, exportSettings *ExportSettings, playlist *Playlist, track *Track, sourceFileLocation string) (string, error) {
+func copyTrack(ctx context.Context, library *Library, exportSettings *ExportSettings, playlist *Playlist, track *Track, sourceFileLocation string) (string, error) {
 	var destinationPath string
 
-	if exportSettings.NewMusicPath != "" {
-		sourceFileLocation = strings.Replace(sourceFileLocation, exportSettings.OriginalMusicPath, exportSettings.NewMusicPath, 1)
-	}
+	sourceFileLocation, _ = exportSettings.musicPathRules().rewrite(sourceFileLocation)
 
 	switch exportSettings.CopyType {
 	case COPY_PLAYLIST:
@@ -157,64 +334,231 @@ func copyTrack(library *Library, exportSettings *ExportSettings, playlist *Playl
 	}
 	dest := filepath.Join(destinationPath, filepath.Base(sourceFileLocation))
 
-	if err := copyFile(sourceFileLocation, dest); err != nil {
+	// Only freshly made copies are tagged, so the originals are never modified.
+	var tag func(string) error
+	if len(exportSettings.TagFields) > 0 {
+		tag = func(path string) error {
+			if err := writeTrackTags(path, filepath.Ext(dest), track, exportSettings.TagFields); err != nil {
+				fmt.Printf("Unable to write tags to %v: %v\n", dest, err.Error())
+			}
+			return nil
+		}
+	}
+
+	options := copyOptions{
+		linkMode: exportSettings.LinkMode,
+		manifest: exportSettings.Manifest,
+		prepare:  tag,
+		fileMode: exportSettings.FileMode,
+		dirMode:  exportSettings.DirMode,
+		modTime: func(source os.FileInfo) time.Time {
+			return trackModTime(exportSettings.ModTime, track, source)
+		},
+		xattrs: exportSettings.Xattrs,
+	}
+	_, err := copyFile(ctx, sourceFileLocation, dest, options)
+	if err != nil {
 		return "", err
 	}
+
+	if exportSettings.Artwork && exportSettings.CopyType == COPY_ITUNES && track.ArtworkCount > 0 {
+		if err := extractArtwork(sourceFileLocation, destinationPath, exportSettings.ArtworkSize, exportSettings.FileMode); err != nil {
+			fmt.Printf("Unable to extract artwork from %v: %v\n", sourceFileLocation, err.Error())
+		}
+	}
 	return dest, nil
 }
 
-func copyFile(src, dest string) error {
-	src = strings.Replace(src, "file://", "", 1)
+// copyFile copies or links src to dest unless dest already exists. It reports whether a copy or link was made.
+// If options.manifest is not nil, a copy is verified and recorded in it, and an existing dest that fails
+// verification is copied again.
+func copyFile(ctx context.Context, src, dest string, options copyOptions) (bool, error) {
+	src = sourceFilePath(src)
 	sourceFileInfo, err := os.Stat(src)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	if !sourceFileInfo.Mode().IsRegular() {
-		return errors.New("source file is not a regular file")
+		return false, errors.New("source file is not a regular file")
 	}
 
 	_, err = os.Stat(dest)
 	if err == nil {
-		// No need to copy.
-		return nil
+		if options.manifest == nil {
+			// No need to copy.
+			return false, nil
+		}
+		ok, err := verifyExistingFile(options.manifest, src, dest, options.prepare != nil)
+		if err != nil || ok {
+			return false, err
+		}
+		fmt.Printf("Checksum mismatch for %v, copying it again.\n", dest)
 	} else if !os.IsNotExist(err) {
-		return err
+		return false, err
 	}
 
 	destDir := filepath.Dir(dest)
 	_, err = os.Stat(destDir)
 	if err != nil {
 		if os.IsNotExist(err) {
-			err = os.MkdirAll(destDir, 0777)
+			err = makeDirs(destDir, options.dirMode)
 			if err != nil {
-				return nil
+				return false, nil
 			}
 		} else {
-			return err
+			return false, err
+		}
+	}
+
+	// Tagged files are always copied, so the originals are never modified through a link.
+	linkMode := options.linkMode
+	if linkMode == LINK_AUTO && options.prepare == nil {
+		linkMode = LINK_HARDLINK
+	}
+	if linkMode == LINK_HARDLINK || linkMode == LINK_SYMLINK {
+		err = linkFile(src, dest, linkMode)
+		if err == nil {
+			if options.manifest != nil {
+				// The link shares the data of the source, so it is recorded with the source checksum.
+				srcSum, err := fileChecksum(src)
+				if err != nil {
+					return true, err
+				}
+				options.manifest.Set(dest, srcSum)
+			}
+			return true, nil
+		}
+		if options.linkMode != LINK_AUTO {
+			fmt.Printf("Unable to %v %v, copying it instead: %v\n", linkModeName(linkMode), src, err)
 		}
 	}
 
-	return copyFileData(src, dest)
+	for attempt := 1; ; attempt++ {
+		err = copyFileData(ctx, src, dest, options)
+		if err != errChecksumMismatch || attempt == verifyAttempts {
+			break
+		}
+		fmt.Printf("Checksum mismatch copying %v, retrying.\n", dest)
+	}
+	if err == errChecksumMismatch {
+		return false, fmt.Errorf("%v after %v attempts", err, verifyAttempts)
+	}
+	return true, err
+}
+
+// sourceFilePath strips any remaining file:// scheme from a track location.
+func sourceFilePath(src string) string {
+	return strings.Replace(src, "file://", "", 1)
 }
 
-func copyFileData(src, dest string) error {
+// copyFileData copies src to dest through an atomicFile, so an interrupted copy never leaves a partial dest.
+// The copy is abandoned as soon as ctx is cancelled. With LINK_REFLINK or LINK_AUTO, the data is cloned
+// if the file system supports it. If options.manifest is not nil, the copy is read back and compared with
+// src before options.prepare is called, and the final dest is recorded in the manifest.
+func copyFileData(ctx context.Context, src, dest string, options copyOptions) error {
+	manifest, prepare := options.manifest, options.prepare
 	in, err := os.Open(src)
 	if err != nil {
 		return err
 	}
 	defer in.Close()
 
-	out, err := os.Create(dest)
+	var modTime time.Time
+	if options.modTime != nil {
+		info, err := in.Stat()
+		if err != nil {
+			return err
+		}
+		modTime = options.modTime(info)
+	}
+
+	out, err := createAtomicFile(dest, options.fileMode)
 	if err != nil {
 		return err
 	}
-	defer out.Close()
+	defer out.Abort()
+
+	cloned := false
+	if options.linkMode == LINK_REFLINK || options.linkMode == LINK_AUTO {
+		err = reflink(out.File, in)
+		cloned = err == nil
+		if err != nil && options.linkMode == LINK_REFLINK {
+			fmt.Printf("Unable to reflink %v, copying it instead: %v\n", src, err)
+		}
+	}
 
-	if _, err = io.Copy(out, in); err != nil {
+	var reader io.Reader = contextReader{ctx, in}
+	var srcHash hash.Hash
+	if manifest != nil {
+		srcHash = sha256.New()
+		reader = io.TeeReader(reader, srcHash)
+	}
+	var size int64
+	if cloned && manifest != nil {
+		// Only hash the source, the data is already in place.
+		size, err = io.Copy(io.Discard, reader)
+	} else if !cloned {
+		size, err = io.Copy(out, reader)
+	}
+	if err != nil {
 		return err
 	}
-	return out.Sync()
+	var srcSum, destSum ManifestEntry
+	if manifest != nil {
+		srcSum = ManifestEntry{size, hex.EncodeToString(srcHash.Sum(nil))}
+	}
+	err = out.Commit(func(path string) error {
+		if manifest != nil {
+			copySum, err := fileChecksum(path)
+			if err != nil {
+				return err
+			}
+			if copySum != srcSum {
+				return errChecksumMismatch
+			}
+			destSum = copySum
+		}
+		if prepare != nil {
+			if err := prepare(path); err != nil {
+				return err
+			}
+			if manifest != nil {
+				// Tagging changes the file, so the manifest records the tagged copy.
+				var err error
+				if destSum, err = fileChecksum(path); err != nil {
+					return err
+				}
+			}
+		}
+		if options.xattrs {
+			if err := copyXattrs(src, path); err != nil {
+				fmt.Printf("Unable to copy extended attributes of %v: %v\n", src, err)
+			}
+		}
+		// Last, as tagging and extended attributes change the modification time.
+		if !modTime.IsZero() {
+			return os.Chtimes(path, modTime, modTime)
+		}
+		return nil
+	})
+	if err == nil && manifest != nil {
+		manifest.Set(dest, destSum)
+	}
+	return err
+}
+
+// contextReader fails reads once its context is cancelled.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
 }
 
 // buildPlaylistPath checks to see if the playlist has any parent folders.
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// Exporting more playlists than the process may have open files must not fail with EMFILE.
+func TestExportPlaylistsClosesPlaylistFiles(t *testing.T) {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		t.Skip(err)
+	}
+	lowered := limit
+	lowered.Cur = 64
+	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &lowered); err != nil {
+		t.Skipf("unable to lower the open file limit: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+			t.Errorf("unable to restore the open file limit: %v", err)
+		}
+	})
+
+	outputDir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(outputDir)
+
+	library := &Library{
+		Tracks: map[string]Track{"1": {TrackId: 1, Name: "Song", Location: "file:///music/song.mp3"}},
+	}
+	var playlists []Playlist
+	for i := 0; i < 4*int(lowered.Cur); i++ {
+		playlists = append(playlists, Playlist{Name: fmt.Sprintf("Mix %v", i), PlaylistItems: []PlaylistItem{{TrackId: 1}}})
+	}
+	exportSettings := &ExportSettings{
+		Library:       library,
+		Playlists:     playlists,
+		ExportType:    M3U,
+		Extension:     "m3u",
+		OutputPath:    outputDir,
+		PathSeparator: "/",
+	}
+	if err := ExportPlaylists(context.Background(), exportSettings, library); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(playlists) {
+		t.Errorf("expected %v playlist files, found %v", len(playlists), len(entries))
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportPlaylistsSkipsUnchangedPlaylists(t *testing.T) {
+	outputDir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(outputDir)
+
+	library := &Library{
+		Tracks: map[string]Track{"1": {TrackId: 1, PersistentId: "AAA", Name: "Song", Location: "file:///music/song.mp3"}},
+	}
+	playlist := Playlist{Name: "Mix", PlaylistPersistentId: "P1", PlaylistItems: []PlaylistItem{{TrackId: 1}}}
+	exportSettings := &ExportSettings{
+		Library:        library,
+		Playlists:      []Playlist{playlist},
+		ExportType:     M3U,
+		Extension:      "m3u",
+		OutputPath:     outputDir,
+		PathSeparator:  "/",
+		PlaylistStates: make(map[string]PlaylistState),
+	}
+	playlistFile := filepath.Join(outputDir, "Mix.m3u")
+
+	if err := ExportPlaylists(context.Background(), exportSettings, library); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, playlistFile, "marker")
+
+	if err := ExportPlaylists(context.Background(), exportSettings, library); err != nil {
+		t.Fatal(err)
+	}
+	if readFile(t, playlistFile) != "marker" {
+		t.Error("expected the unchanged playlist not to be written again")
+	}
+
+	library.Tracks["1"] = Track{TrackId: 1, PersistentId: "AAA", Name: "Song", Location: "file:///music/moved.mp3"}
+	if err := ExportPlaylists(context.Background(), exportSettings, library); err != nil {
+		t.Fatal(err)
+	}
+	if readFile(t, playlistFile) == "marker" {
+		t.Error("expected the changed playlist to be written again")
+	}
+}
+
+func TestExportStateRemovesDeletedPlaylists(t *testing.T) {
+	outputDir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(outputDir)
+
+	library := &Library{
+		Tracks: map[string]Track{"1": {TrackId: 1, PersistentId: "AAA", Name: "Song", Location: "file:///music/song.mp3"}},
+	}
+	mix := Playlist{Name: "Mix", PlaylistPersistentId: "P1", PlaylistItems: []PlaylistItem{{TrackId: 1}}}
+	other := Playlist{Name: "Other", PlaylistPersistentId: "P2", PlaylistItems: []PlaylistItem{{TrackId: 1}}}
+	export := func(playlists ...Playlist) {
+		states, err := loadExportState(outputDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exportSettings := &ExportSettings{
+			Library:        library,
+			Playlists:      playlists,
+			ExportType:     M3U,
+			Extension:      "m3u",
+			OutputPath:     outputDir,
+			PathSeparator:  "/",
+			PlaylistStates: states,
+		}
+		if err = ExportPlaylists(context.Background(), exportSettings, library); err != nil {
+			t.Fatal(err)
+		}
+		if err = saveExportState(outputDir, states); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	export(mix, other)
+	writeFile(t, filepath.Join(outputDir, "Mix.m3u"), "marker")
+
+	export(mix)
+	if readFile(t, filepath.Join(outputDir, "Mix.m3u")) != "marker" {
+		t.Error("expected the unchanged playlist not to be written again")
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "Other.m3u")); !os.IsNotExist(err) {
+		t.Error("expected the playlist that is no longer exported to be removed")
+	}
+
+	mix.Name = "Renamed"
+	export(mix)
+	if _, err := os.Stat(filepath.Join(outputDir, "Mix.m3u")); !os.IsNotExist(err) {
+		t.Error("expected the file of the renamed playlist to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "Renamed.m3u")); err != nil {
+		t.Error("expected the renamed playlist to be written")
+	}
+}
+
+func TestExportFoldersAsMergedPlaylists(t *testing.T) {
+	outputDir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(outputDir)
+
+	library := &Library{
+		Tracks: map[string]Track{
+			"1": {TrackId: 1, Name: "One", Location: "file:///music/1.mp3"},
+			"2": {TrackId: 2, Name: "Two", Location: "file:///music/2.mp3"},
+			"3": {TrackId: 3, Name: "Three", Location: "file:///music/3.mp3"},
+		},
+		Playlists: []Playlist{
+			{Name: "Workouts", PlaylistPersistentId: "F1", Folder: true},
+			{Name: "Run", PlaylistPersistentId: "P1", ParentPersistentId: "F1", PlaylistItems: []PlaylistItem{{TrackId: 1}, {TrackId: 2}}},
+			{Name: "Slow", PlaylistPersistentId: "F2", ParentPersistentId: "F1", Folder: true},
+			{Name: "Walk", PlaylistPersistentId: "P2", ParentPersistentId: "F2", PlaylistItems: []PlaylistItem{{TrackId: 2}, {TrackId: 3}}},
+		},
+		PlaylistIdMap: make(map[string]Playlist),
+	}
+	for _, playlist := range library.Playlists {
+		library.PlaylistIdMap[playlist.PlaylistPersistentId] = playlist
+	}
+	exportSettings := &ExportSettings{
+		Library:       library,
+		Playlists:     library.Playlists,
+		ExportType:    M3U,
+		Extension:     "m3u",
+		OutputPath:    outputDir,
+		PathSeparator: "/",
+	}
+
+	if err := ExportPlaylists(context.Background(), exportSettings, library); err != nil {
+		t.Fatal(err)
+	}
+	assertDirEntries(t, outputDir, "Run.m3u", "Walk.m3u")
+
+	exportSettings.ExportFolders = true
+	if err := ExportPlaylists(context.Background(), exportSettings, library); err != nil {
+		t.Fatal(err)
+	}
+	assertDirEntries(t, outputDir, "Run.m3u", "Slow.m3u", "Walk.m3u", "Workouts.m3u")
+	// The first line is the header comment.
+	if content := readFile(t, filepath.Join(outputDir, "Workouts.m3u")); strings.SplitN(content, "\n", 2)[1] != "/music/1.mp3\n/music/2.mp3\n/music/3.mp3\n" {
+		t.Errorf("unexpected folder playlist %q", content)
+	}
+	if content := readFile(t, filepath.Join(outputDir, "Slow.m3u")); strings.SplitN(content, "\n", 2)[1] != "/music/2.mp3\n/music/3.mp3\n" {
+		t.Errorf("unexpected nested folder playlist %q", content)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// The modification time given to copied tracks.
+const (
+	MTIME_SOURCE = iota
+	MTIME_MODIFIED
+	MTIME_ADDED
+	MTIME_NOW
+)
+
+// makeDirs creates dir and any missing parents. The folders it creates get mode exactly, regardless of
+// the umask, or 0777 less the umask if mode is zero. Existing folders are left untouched.
+func makeDirs(dir string, mode os.FileMode) error {
+	if mode == 0 {
+		return os.MkdirAll(dir, 0777)
+	}
+
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil {
+			break
+		}
+		missing = append(missing, d)
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	if err := os.MkdirAll(dir, mode); err != nil {
+		return err
+	}
+	for _, d := range missing {
+		if err := os.Chmod(d, mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trackModTime returns the modification time for a copy of the track, as selected by one of the MTIME_
+// constants. The source file's modification time is used if the track has no such date.
+// A zero time means the copy keeps the time it was written.
+func trackModTime(mtime int, track *Track, source os.FileInfo) time.Time {
+	switch mtime {
+	case MTIME_NOW:
+		return time.Time{}
+	case MTIME_MODIFIED:
+		if !track.DateModified.IsZero() {
+			return track.DateModified
+		}
+	case MTIME_ADDED:
+		if !track.DateAdded.IsZero() {
+			return track.DateAdded
+		}
+	}
+	return source.ModTime()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCopyFileAppliesModesAndModTime(t *testing.T) {
+	outputDir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(outputDir)
+	src := filepath.Join(outputDir, "song.mp3")
+	writeFile(t, src, FileContent)
+	sourceTime := time.Date(2010, 5, 1, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(src, sourceTime, sourceTime); err != nil {
+		t.Fatal(err)
+	}
+	added := time.Date(2015, 3, 2, 8, 30, 0, 0, time.UTC)
+	track := &Track{DateAdded: added}
+
+	tests := []struct {
+		name    string
+		mtime   int
+		modTime time.Time
+	}{
+		{"source", MTIME_SOURCE, sourceTime},
+		{"added", MTIME_ADDED, added},
+		{"modified", MTIME_MODIFIED, sourceTime},
+	}
+	for _, test := range tests {
+		mtime := test.mtime
+		dest := filepath.Join(outputDir, test.name, "Album", "song.mp3")
+		options := copyOptions{
+			fileMode: 0600,
+			dirMode:  0700,
+			modTime: func(source os.FileInfo) time.Time {
+				return trackModTime(mtime, track, source)
+			},
+		}
+		if _, err := copyFile(context.Background(), src, dest, options); err != nil {
+			t.Fatal(err)
+		}
+
+		info, err := os.Stat(dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(test.modTime) {
+			t.Errorf("%v: expected modification time %v, got %v", test.name, test.modTime, info.ModTime())
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("%v: expected file mode 0600, got %v", test.name, info.Mode().Perm())
+		}
+		for _, dir := range []string{filepath.Dir(dest), filepath.Dir(filepath.Dir(dest))} {
+			info, err = os.Stat(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != 0700 {
+				t.Errorf("%v: expected folder mode 0700 for %v, got %v", test.name, dir, info.Mode().Perm())
+			}
+		}
+	}
+}
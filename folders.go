@@ -0,0 +1,100 @@
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// FolderSelectorPrefix marks an include or exclude parameter as an iTunes folder path, e.g. folder:"Archive/2019".
+const FolderSelectorPrefix = "folder:"
+
+// parseFolderSelector returns the folder path of an include or exclude parameter starting with folder:.
+// The path may be quoted, in case the quotes reach the program.
+func parseFolderSelector(value string) (string, bool) {
+	if !strings.HasPrefix(value, FolderSelectorPrefix) {
+		return "", false
+	}
+	path := strings.TrimPrefix(value, FolderSelectorPrefix)
+	if unquoted, err := strconv.Unquote(path); err == nil {
+		path = unquoted
+	}
+	return path, true
+}
+
+// folderPath returns the path of a folder, as computed by buildPlaylistPath, with / as the separator.
+func folderPath(folder Playlist, library *Library) string {
+	return filepath.ToSlash(buildPlaylistPath(folder, library))
+}
+
+// safeFolderPath makes the names in a folder path, e.g. Archive/2019, safe the same way as in
+// buildPlaylistPath, so folders can be selected with the names shown in iTunes.
+func safeFolderPath(path string) string {
+	var segments []string
+	for _, name := range strings.Split(strings.Trim(path, "/"), "/") {
+		segments = append(segments, Playlist{Name: name}.SafeName())
+	}
+	return strings.Join(segments, "/")
+}
+
+// playlistAncestors returns the playlist followed by the folders it is in, innermost first.
+func playlistAncestors(playlist Playlist, library *Library) []Playlist {
+	ancestors := []Playlist{playlist}
+	seen := make(map[string]bool)
+	for playlist.ParentPersistentId != "" && !seen[playlist.ParentPersistentId] {
+		seen[playlist.ParentPersistentId] = true
+		parent, ok := library.PlaylistIdMap[playlist.ParentPersistentId]
+		if !ok {
+			break
+		}
+		ancestors = append(ancestors, parent)
+		playlist = parent
+	}
+	return ancestors
+}
+
+// isInFolder reports whether the playlist is the folder or one of its descendants, at any depth.
+func isInFolder(playlist Playlist, folder Playlist, library *Library) bool {
+	if folder.PlaylistPersistentId == "" {
+		return false
+	}
+	for _, ancestor := range playlistAncestors(playlist, library) {
+		if ancestor.PlaylistPersistentId == folder.PlaylistPersistentId {
+			return true
+		}
+	}
+	return false
+}
+
+// expandFolder returns the folder and everything below it, at any depth and in library order.
+func expandFolder(folder Playlist, library *Library) []Playlist {
+	var playlists []Playlist
+	for _, playlist := range library.Playlists {
+		if isInFolder(playlist, folder, library) {
+			playlists = append(playlists, playlist)
+		}
+	}
+	return playlists
+}
+
+// mergeFolder returns the folder as a playlist of the tracks of all the playlists inside it, at any depth.
+// Each track is included once, at its first position. The playlist is written next to the folder.
+func mergeFolder(folder Playlist, library *Library) Playlist {
+	merged := folder
+	merged.Folder = false
+	merged.PlaylistItems = nil
+
+	seen := make(map[int]bool)
+	for _, playlist := range expandFolder(folder, library) {
+		if playlist.Folder {
+			continue
+		}
+		for _, item := range playlist.PlaylistItems {
+			if !seen[item.TrackId] {
+				seen[item.TrackId] = true
+				merged.PlaylistItems = append(merged.PlaylistItems, item)
+			}
+		}
+	}
+	return merged
+}
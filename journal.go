@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// JournalFileName is the file in the output directory that records the progress of a running export.
+const JournalFileName = ".itunesexport-journal"
+
+// Journal records each playlist as soon as it has been exported. It is removed once the export completes,
+// so a journal left behind belongs to an interrupted export, which -resume continues.
+type Journal struct {
+	file      *os.File
+	completed map[string]PlaylistState
+}
+
+type journalEntry struct {
+	Key string `json:"key"`
+	PlaylistState
+}
+
+// openJournal starts the journal in the output directory. If resume is set, the playlists recorded
+// by an interrupted export are kept, otherwise the journal starts empty.
+func openJournal(outputPath string, resume bool) (*Journal, error) {
+	path := filepath.Join(outputPath, JournalFileName)
+	journal := &Journal{completed: make(map[string]PlaylistState)}
+
+	flag := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if resume {
+		data, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			var entry journalEntry
+			// The last entry may be incomplete if the export was killed while writing it.
+			if json.Unmarshal(scanner.Bytes(), &entry) == nil {
+				journal.completed[entry.Key] = entry.PlaylistState
+			}
+		}
+	} else {
+		flag |= os.O_TRUNC
+	}
+
+	file, err := os.OpenFile(path, flag, 0666)
+	if err != nil {
+		return nil, err
+	}
+	journal.file = file
+	return journal, nil
+}
+
+// Completed reports whether the playlist was exported with the same hash before the export was interrupted.
+func (j *Journal) Completed(key string, hash string) bool {
+	if j == nil {
+		return false
+	}
+	state, ok := j.completed[key]
+	return ok && state.Hash == hash
+}
+
+// Record adds an exported playlist to the journal and flushes it to disk.
+func (j *Journal) Record(key string, state PlaylistState) error {
+	if j == nil {
+		return nil
+	}
+	data, err := json.Marshal(journalEntry{key, state})
+	if err != nil {
+		return err
+	}
+	if _, err = j.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+// Close closes the journal and keeps it, so the export can be resumed.
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
+
+// Remove closes and deletes the journal once the export has completed.
+func (j *Journal) Remove() error {
+	j.file.Close()
+	return os.Remove(j.file.Name())
+}
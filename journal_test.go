@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExportPlaylistsCancelled(t *testing.T) {
+	outputDir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(outputDir)
+	src := filepath.Join(outputDir, "song.mp3")
+	writeFile(t, src, FileContent)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	copiesDir := filepath.Join(outputDir, "copies")
+	os.Mkdir(copiesDir, 0777)
+	if err := copyFileData(ctx, src, filepath.Join(copiesDir, "song.mp3"), copyOptions{}); err != context.Canceled {
+		t.Errorf("expected the copy to be cancelled, got %v", err)
+	}
+	assertDirEntries(t, copiesDir)
+
+	library := &Library{
+		Tracks: map[string]Track{"1": {TrackId: 1, Name: "Song", Location: "file://" + filepath.ToSlash(src)}},
+	}
+	exportSettings := &ExportSettings{
+		Library:       library,
+		Playlists:     []Playlist{{Name: "Mix", PlaylistItems: []PlaylistItem{{TrackId: 1}}}},
+		ExportType:    M3U,
+		Extension:     "m3u",
+		OutputPath:    copiesDir,
+		CopyType:      COPY_FLAT,
+		PathSeparator: "/",
+	}
+	if err := ExportPlaylists(ctx, exportSettings, library); err != context.Canceled {
+		t.Errorf("expected the export to be cancelled, got %v", err)
+	}
+	assertDirEntries(t, copiesDir)
+}
+
+func TestExportPlaylistsResumesFromJournal(t *testing.T) {
+	outputDir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(outputDir)
+
+	library := &Library{
+		Tracks: map[string]Track{"1": {TrackId: 1, Name: "Song", Location: "file:///music/song.mp3"}},
+	}
+	first := Playlist{Name: "First", PlaylistPersistentId: "P1", PlaylistItems: []PlaylistItem{{TrackId: 1}}}
+	second := Playlist{Name: "Second", PlaylistPersistentId: "P2", PlaylistItems: []PlaylistItem{{TrackId: 1}}}
+	exportSettings := &ExportSettings{
+		Library:        library,
+		ExportType:     M3U,
+		Extension:      "m3u",
+		OutputPath:     outputDir,
+		PathSeparator:  "/",
+		PlaylistStates: make(map[string]PlaylistState),
+	}
+
+	// An export that was interrupted after the first playlist.
+	journal, err := openJournal(outputDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exportSettings.Journal = journal
+	exportSettings.Playlists = []Playlist{first}
+	if err = ExportPlaylists(context.Background(), exportSettings, library); err != nil {
+		t.Fatal(err)
+	}
+	journal.Close()
+	writeFile(t, filepath.Join(outputDir, "First.m3u"), "marker")
+
+	journal, err = openJournal(outputDir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exportSettings.Journal = journal
+	exportSettings.Playlists = []Playlist{first, second}
+	exportSettings.PlaylistStates = make(map[string]PlaylistState)
+	if err = ExportPlaylists(context.Background(), exportSettings, library); err != nil {
+		t.Fatal(err)
+	}
+	if err = journal.Remove(); err != nil {
+		t.Fatal(err)
+	}
+
+	if readFile(t, filepath.Join(outputDir, "First.m3u")) != "marker" {
+		t.Error("expected the playlist in the journal not to be exported again")
+	}
+	if _, ok := exportSettings.PlaylistStates["P1"]; !ok {
+		t.Error("expected the playlist in the journal to be recorded in the state")
+	}
+	assertDirEntries(t, outputDir, "First.m3u", "Second.m3u")
+}
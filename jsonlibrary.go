@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JSONSchemaVersion is the version of the JSON library schema. It is increased whenever a field is
+// removed or changes meaning; new fields may be added without changing the version.
+//
+// A JSON document is a single JSONLibrary object. NDJSON output writes one object per line: first the
+// library itself, then each track, then each playlist, distinguished by their "type" field, which is
+// "library", "track" or "playlist". Times are RFC 3339 strings and are omitted when unset. Ratings are
+// normalised to stars between 0 and 5. Playlist folders are playlists with "folder" set, and playlists
+// inside a folder reference it with "parentPersistentId". Playlist members are listed by track persistent ID.
+const JSONSchemaVersion = 1
+
+// JSONLibrary is the top level object of a JSON library document.
+type JSONLibrary struct {
+	Type                string         `json:"type,omitempty"`
+	SchemaVersion       int            `json:"schemaVersion"`
+	MajorVersion        int            `json:"majorVersion"`
+	MinorVersion        int            `json:"minorVersion"`
+	Date                *time.Time     `json:"date,omitempty"`
+	ApplicationVersion  int            `json:"applicationVersion,omitempty"`
+	Features            int            `json:"features,omitempty"`
+	ShowContentRating   bool           `json:"showContentRating,omitempty"`
+	MusicFolder         string         `json:"musicFolder,omitempty"`
+	LibraryPersistentId string         `json:"libraryPersistentId,omitempty"`
+	Tracks              []JSONTrack    `json:"tracks,omitempty"`
+	Playlists           []JSONPlaylist `json:"playlists,omitempty"`
+}
+
+// JSONTrack is a track of the library.
+type JSONTrack struct {
+	Type                string     `json:"type,omitempty"`
+	TrackId             int        `json:"trackId"`
+	PersistentId        string     `json:"persistentId"`
+	Name                string     `json:"name,omitempty"`
+	Artist              string     `json:"artist,omitempty"`
+	AlbumArtist         string     `json:"albumArtist,omitempty"`
+	Composer            string     `json:"composer,omitempty"`
+	Album               string     `json:"album,omitempty"`
+	Genre               string     `json:"genre,omitempty"`
+	Kind                string     `json:"kind,omitempty"`
+	Size                int        `json:"size,omitempty"`
+	TotalTime           int        `json:"totalTimeMs,omitempty"`
+	StartTime           int        `json:"startTimeMs,omitempty"`
+	StopTime            int        `json:"stopTimeMs,omitempty"`
+	TrackNumber         int        `json:"trackNumber,omitempty"`
+	TrackCount          int        `json:"trackCount,omitempty"`
+	DiscNumber          int        `json:"discNumber,omitempty"`
+	DiscCount           int        `json:"discCount,omitempty"`
+	Year                int        `json:"year,omitempty"`
+	DateModified        *time.Time `json:"dateModified,omitempty"`
+	DateAdded           *time.Time `json:"dateAdded,omitempty"`
+	BitRate             int        `json:"bitRate,omitempty"`
+	SampleRate          int        `json:"sampleRate,omitempty"`
+	PlayCount           int        `json:"playCount,omitempty"`
+	PlayDate            *time.Time `json:"playDate,omitempty"`
+	SkipCount           int        `json:"skipCount,omitempty"`
+	SkipDate            *time.Time `json:"skipDate,omitempty"`
+	Rating              float64    `json:"rating,omitempty"`
+	AlbumRating         float64    `json:"albumRating,omitempty"`
+	AlbumRatingComputed bool       `json:"albumRatingComputed,omitempty"`
+	ArtworkCount        int        `json:"artworkCount,omitempty"`
+	TrackType           string     `json:"trackType,omitempty"`
+	Location            string     `json:"location,omitempty"`
+	FileFolderCount     int        `json:"fileFolderCount,omitempty"`
+	LibraryFolderCount  int        `json:"libraryFolderCount,omitempty"`
+	Loved               bool       `json:"loved,omitempty"`
+	Disabled            bool       `json:"disabled,omitempty"`
+	Comments            string     `json:"comments,omitempty"`
+	SortName            string     `json:"sortName,omitempty"`
+	SortAlbum           string     `json:"sortAlbum,omitempty"`
+	SortAlbumArtist     string     `json:"sortAlbumArtist,omitempty"`
+	SortArtist          string     `json:"sortArtist,omitempty"`
+	SortComposer        string     `json:"sortComposer,omitempty"`
+	Work                string     `json:"work,omitempty"`
+	Grouping            string     `json:"grouping,omitempty"`
+	VolumeAdjustment    int        `json:"volumeAdjustment,omitempty"`
+}
+
+// JSONPlaylist is a playlist or playlist folder of the library.
+type JSONPlaylist struct {
+	Type               string   `json:"type,omitempty"`
+	PlaylistId         int      `json:"playlistId"`
+	PersistentId       string   `json:"persistentId"`
+	ParentPersistentId string   `json:"parentPersistentId,omitempty"`
+	Name               string   `json:"name"`
+	Master             bool     `json:"master,omitempty"`
+	DistinguishedKind  int      `json:"distinguishedKind,omitempty"`
+	Visible            bool     `json:"visible,omitempty"`
+	AllItems           bool     `json:"allItems,omitempty"`
+	Folder             bool     `json:"folder,omitempty"`
+	Smart              bool     `json:"smart,omitempty"`
+	SmartInfo          []byte   `json:"smartInfo,omitempty"`
+	SmartCriteria      []byte   `json:"smartCriteria,omitempty"`
+	TrackPersistentIds []string `json:"trackPersistentIds"`
+}
+
+// dumpCommand writes the library as JSON or NDJSON.
+func dumpCommand(args []string) error {
+	var libraryPath, format, output string
+	flags := newCommandFlags("dump", &libraryPath)
+	flags.StringVar(&format, "format", "json", "")
+	flags.StringVar(&output, "output", "", "")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	format = strings.ToLower(format)
+	if format != "json" && format != "ndjson" {
+		return errors.New("Unknown Format: " + format)
+	}
+
+	library, err := loadCommandLibrary(libraryPath)
+	if err != nil {
+		return err
+	}
+
+	w, closeOutput, err := commandOutput(output)
+	if err != nil {
+		return err
+	}
+	if format == "json" {
+		err = writeLibraryJSON(w, library)
+	} else {
+		err = writeLibraryNDJSON(w, library)
+	}
+	if closeErr := closeOutput(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func writeLibraryJSON(w io.Writer, library *Library) error {
+	jsonLibrary := newJSONLibrary(library)
+	for _, track := range sortedLibraryTracks(library) {
+		jsonLibrary.Tracks = append(jsonLibrary.Tracks, newJSONTrack(&track))
+	}
+	for _, playlist := range library.Playlists {
+		jsonLibrary.Playlists = append(jsonLibrary.Playlists, newJSONPlaylist(&playlist, library))
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(jsonLibrary)
+}
+
+func writeLibraryNDJSON(w io.Writer, library *Library) error {
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+
+	jsonLibrary := newJSONLibrary(library)
+	jsonLibrary.Type = "library"
+	if err := encoder.Encode(jsonLibrary); err != nil {
+		return err
+	}
+	for _, track := range sortedLibraryTracks(library) {
+		jsonTrack := newJSONTrack(&track)
+		jsonTrack.Type = "track"
+		if err := encoder.Encode(jsonTrack); err != nil {
+			return err
+		}
+	}
+	for _, playlist := range library.Playlists {
+		jsonPlaylist := newJSONPlaylist(&playlist, library)
+		jsonPlaylist.Type = "playlist"
+		if err := encoder.Encode(jsonPlaylist); err != nil {
+			return err
+		}
+	}
+	return buffered.Flush()
+}
+
+func newJSONLibrary(library *Library) JSONLibrary {
+	return JSONLibrary{
+		SchemaVersion:       JSONSchemaVersion,
+		MajorVersion:        library.MajorVersion,
+		MinorVersion:        library.MinorVersion,
+		Date:                jsonTime(library.Date),
+		ApplicationVersion:  library.ApplicationVersion,
+		Features:            library.Features,
+		ShowContentRating:   library.ShowContentRating,
+		MusicFolder:         library.MusicFolder,
+		LibraryPersistentId: library.LibraryPersistentId,
+	}
+}
+
+func newJSONTrack(track *Track) JSONTrack {
+	return JSONTrack{
+		TrackId:             track.TrackId,
+		PersistentId:        track.PersistentId,
+		Name:                track.Name,
+		Artist:              track.Artist,
+		AlbumArtist:         track.AlbumArtist,
+		Composer:            track.Composer,
+		Album:               track.Album,
+		Genre:               track.Genre,
+		Kind:                track.Kind,
+		Size:                track.Size,
+		TotalTime:           track.TotalTime,
+		StartTime:           track.StartTime,
+		StopTime:            track.StopTime,
+		TrackNumber:         track.TrackNumber,
+		TrackCount:          track.TrackCount,
+		DiscNumber:          track.DiscNumber,
+		DiscCount:           track.DiscCount,
+		Year:                track.Year,
+		DateModified:        jsonTime(track.DateModified),
+		DateAdded:           jsonTime(track.DateAdded),
+		BitRate:             track.BitRate,
+		SampleRate:          track.SampleRate,
+		PlayCount:           track.PlayCount,
+		PlayDate:            jsonTime(track.PlayDateUTC),
+		SkipCount:           track.SkipCount,
+		SkipDate:            jsonTime(track.SkipDate),
+		Rating:              float64(track.Rating) / 20,
+		AlbumRating:         float64(track.AlbumRating) / 20,
+		AlbumRatingComputed: track.AlbumRatingComputed,
+		ArtworkCount:        track.ArtworkCount,
+		TrackType:           track.TrackType,
+		Location:            track.Location,
+		FileFolderCount:     track.FileFolderCount,
+		LibraryFolderCount:  track.LibraryFolderCount,
+		Loved:               track.Loved,
+		Disabled:            track.Disabled,
+		Comments:            track.Comments,
+		SortName:            track.SortName,
+		SortAlbum:           track.SortAlbum,
+		SortAlbumArtist:     track.SortAlbumArtist,
+		SortArtist:          track.SortArtist,
+		SortComposer:        track.SortComposer,
+		Work:                track.Work,
+		Grouping:            track.Grouping,
+		VolumeAdjustment:    track.VolumeAdjustment,
+	}
+}
+
+func newJSONPlaylist(playlist *Playlist, library *Library) JSONPlaylist {
+	jsonPlaylist := JSONPlaylist{
+		PlaylistId:         playlist.PlaylistId,
+		PersistentId:       playlist.PlaylistPersistentId,
+		ParentPersistentId: playlist.ParentPersistentId,
+		Name:               playlist.Name,
+		Master:             playlist.Master,
+		DistinguishedKind:  playlist.DistinguishedKind,
+		Visible:            playlist.Visible,
+		AllItems:           playlist.AllItems,
+		Folder:             playlist.Folder,
+		Smart:              len(playlist.SmartCriteria) > 0,
+		SmartInfo:          playlist.SmartInfo,
+		SmartCriteria:      playlist.SmartCriteria,
+		TrackPersistentIds: []string{},
+	}
+	for _, track := range playlist.Tracks(library) {
+		jsonPlaylist.TrackPersistentIds = append(jsonPlaylist.TrackPersistentIds, track.PersistentId)
+	}
+	return jsonPlaylist
+}
+
+func jsonTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
+
+func libraryTime(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
+
+// decodeJSONLibrary reads a library written by the dump command, in either JSON or NDJSON format.
+func decodeJSONLibrary(r io.Reader) (*Library, error) {
+	decoder := json.NewDecoder(r)
+
+	var first json.RawMessage
+	if err := decoder.Decode(&first); err != nil {
+		return nil, err
+	}
+	var jsonLibrary JSONLibrary
+	if err := json.Unmarshal(first, &jsonLibrary); err != nil {
+		return nil, err
+	}
+	if jsonLibrary.SchemaVersion != JSONSchemaVersion {
+		return nil, fmt.Errorf("unsupported JSON library schema version %v", jsonLibrary.SchemaVersion)
+	}
+
+	if jsonLibrary.Type == "library" {
+		for decoder.More() {
+			var record struct {
+				Type string `json:"type"`
+			}
+			var raw json.RawMessage
+			if err := decoder.Decode(&raw); err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(raw, &record); err != nil {
+				return nil, err
+			}
+			var err error
+			switch record.Type {
+			case "track":
+				var track JSONTrack
+				err = json.Unmarshal(raw, &track)
+				jsonLibrary.Tracks = append(jsonLibrary.Tracks, track)
+			case "playlist":
+				var playlist JSONPlaylist
+				err = json.Unmarshal(raw, &playlist)
+				jsonLibrary.Playlists = append(jsonLibrary.Playlists, playlist)
+			default:
+				err = fmt.Errorf("unknown record type %q", record.Type)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return jsonLibrary.library(), nil
+}
+
+// library converts the JSON model back into a Library. The lookup maps are not populated.
+func (jsonLibrary *JSONLibrary) library() *Library {
+	library := &Library{
+		MajorVersion:        jsonLibrary.MajorVersion,
+		MinorVersion:        jsonLibrary.MinorVersion,
+		Date:                libraryTime(jsonLibrary.Date),
+		ApplicationVersion:  jsonLibrary.ApplicationVersion,
+		Features:            jsonLibrary.Features,
+		ShowContentRating:   jsonLibrary.ShowContentRating,
+		MusicFolder:         jsonLibrary.MusicFolder,
+		LibraryPersistentId: jsonLibrary.LibraryPersistentId,
+		Tracks:              make(map[string]Track),
+	}
+
+	trackIds := make(map[string]int)
+	for _, t := range jsonLibrary.Tracks {
+		trackIds[t.PersistentId] = t.TrackId
+		library.Tracks[strconv.Itoa(t.TrackId)] = Track{
+			TrackId:             t.TrackId,
+			Name:                t.Name,
+			Artist:              t.Artist,
+			AlbumArtist:         t.AlbumArtist,
+			Composer:            t.Composer,
+			Album:               t.Album,
+			Genre:               t.Genre,
+			Kind:                t.Kind,
+			Size:                t.Size,
+			TotalTime:           t.TotalTime,
+			StartTime:           t.StartTime,
+			StopTime:            t.StopTime,
+			TrackNumber:         t.TrackNumber,
+			TrackCount:          t.TrackCount,
+			DiscNumber:          t.DiscNumber,
+			DiscCount:           t.DiscCount,
+			Year:                t.Year,
+			DateModified:        libraryTime(t.DateModified),
+			DateAdded:           libraryTime(t.DateAdded),
+			BitRate:             t.BitRate,
+			SampleRate:          t.SampleRate,
+			PlayCount:           t.PlayCount,
+			PlayDateUTC:         libraryTime(t.PlayDate),
+			SkipCount:           t.SkipCount,
+			SkipDate:            libraryTime(t.SkipDate),
+			Rating:              int(t.Rating*20 + 0.5),
+			AlbumRating:         int(t.AlbumRating*20 + 0.5),
+			AlbumRatingComputed: t.AlbumRatingComputed,
+			ArtworkCount:        t.ArtworkCount,
+			PersistentId:        t.PersistentId,
+			TrackType:           t.TrackType,
+			Location:            t.Location,
+			FileFolderCount:     t.FileFolderCount,
+			LibraryFolderCount:  t.LibraryFolderCount,
+			Loved:               t.Loved,
+			Disabled:            t.Disabled,
+			Comments:            t.Comments,
+			SortName:            t.SortName,
+			SortAlbum:           t.SortAlbum,
+			SortAlbumArtist:     t.SortAlbumArtist,
+			SortArtist:          t.SortArtist,
+			SortComposer:        t.SortComposer,
+			Work:                t.Work,
+			Grouping:            t.Grouping,
+			VolumeAdjustment:    t.VolumeAdjustment,
+		}
+	}
+
+	for _, p := range jsonLibrary.Playlists {
+		playlist := Playlist{
+			Name:                 p.Name,
+			Master:               p.Master,
+			PlaylistId:           p.PlaylistId,
+			PlaylistPersistentId: p.PersistentId,
+			ParentPersistentId:   p.ParentPersistentId,
+			DistinguishedKind:    p.DistinguishedKind,
+			Visible:              p.Visible,
+			AllItems:             p.AllItems,
+			Folder:               p.Folder,
+			SmartInfo:            p.SmartInfo,
+			SmartCriteria:        p.SmartCriteria,
+		}
+		for _, persistentId := range p.TrackPersistentIds {
+			if trackId, ok := trackIds[persistentId]; ok {
+				playlist.PlaylistItems = append(playlist.PlaylistItems, PlaylistItem{TrackId: trackId})
+			}
+		}
+		library.Playlists = append(library.Playlists, playlist)
+	}
+	return library
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLibraryJSONRoundTrip(t *testing.T) {
+	added := time.Date(2021, 6, 1, 8, 30, 0, 0, time.UTC)
+	library := &Library{
+		MajorVersion: 1,
+		MusicFolder:  "file:///Music/",
+		Tracks: map[string]Track{
+			"7": {TrackId: 7, PersistentId: "AAA", Name: "Song", Rating: 80, DateAdded: added},
+			"9": {TrackId: 9, PersistentId: "BBB", Name: "Other"},
+		},
+		Playlists: []Playlist{
+			{Name: "Folder", PlaylistPersistentId: "F1", Folder: true},
+			{Name: "Mix", PlaylistPersistentId: "P1", ParentPersistentId: "F1",
+				PlaylistItems: []PlaylistItem{{TrackId: 9}, {TrackId: 7}}},
+		},
+	}
+
+	writers := map[string]func(*bytes.Buffer) error{
+		"json":   func(b *bytes.Buffer) error { return writeLibraryJSON(b, library) },
+		"ndjson": func(b *bytes.Buffer) error { return writeLibraryNDJSON(b, library) },
+	}
+	for format, write := range writers {
+		var buf bytes.Buffer
+		if err := write(&buf); err != nil {
+			t.Fatalf("%v: %v", format, err)
+		}
+
+		loaded, err := decodeJSONLibrary(&buf)
+		if err != nil {
+			t.Fatalf("%v: %v", format, err)
+		}
+
+		track := loaded.Tracks["7"]
+		if track.Name != "Song" || track.Rating != 80 || !track.DateAdded.Equal(added) {
+			t.Errorf("%v: unexpected track %+v", format, track)
+		}
+		if loaded.MusicFolder != "file:///Music/" || len(loaded.Playlists) != 2 {
+			t.Errorf("%v: unexpected library %+v", format, loaded)
+		}
+		mix := loaded.Playlists[1]
+		if mix.ParentPersistentId != "F1" || len(mix.PlaylistItems) != 2 || mix.PlaylistItems[0].TrackId != 9 {
+			t.Errorf("%v: unexpected playlist %+v", format, mix)
+		}
+	}
+}
+
+func TestDecodeJSONLibraryRejectsUnknownVersion(t *testing.T) {
+	_, err := decodeJSONLibrary(bytes.NewBufferString(`{"schemaVersion": 99}`))
+	if err == nil {
+		t.Error("expected an error for an unknown schema version")
+	}
+}
+
+func TestDumpCommandUnknownFormatLeavesOutput(t *testing.T) {
+	dir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "library.json")
+	writeFile(t, output, "previous")
+
+	if err := dumpCommand([]string{"-format", "xml", "-output", output}); err == nil || err.Error() != "Unknown Format: xml" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if readFile(t, output) != "previous" {
+		t.Error("expected the output file to be left untouched")
+	}
+}
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"bufio"
+	"io"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	plist "howett.net/plist"
 )
@@ -92,6 +96,12 @@ type Playlist struct {
 	PlaylistItems        []PlaylistItem `plist:"Playlist Items"`
 }
 
+// IncludedByIncludeAll reports whether -includeAll exports the playlist, i.e. it is neither the master
+// Library nor a builtin playlist with a Distinguished Kind.
+func (p Playlist) IncludedByIncludeAll() bool {
+	return p.DistinguishedKind == 0 && p.Name != "Library"
+}
+
 func (p Playlist) SafeName() string {
 	return illegalChars.ReplaceAllString(p.Name, "_")
 }
@@ -109,13 +119,21 @@ func LoadLibrary(fileLocation string) (*Library, error) {
 	if pathErr != nil {
 		return nil, pathErr
 	}
-
-	decoder := plist.NewDecoder(file)
+	defer file.Close()
 
 	var library Library
-	decodeErr := decoder.Decode(&library)
-	if decodeErr != nil {
-		return nil, decodeErr
+	if isJSONFile(file) {
+		jsonLibrary, decodeErr := decodeJSONLibrary(file)
+		if decodeErr != nil {
+			return nil, decodeErr
+		}
+		library = *jsonLibrary
+	} else {
+		decoder := plist.NewDecoder(file)
+		decodeErr := decoder.Decode(&library)
+		if decodeErr != nil {
+			return nil, decodeErr
+		}
 	}
 
 	library.PlaylistMap = make(map[string]Playlist)
@@ -135,6 +153,22 @@ func LoadLibrary(fileLocation string) (*Library, error) {
 	return &library, nil
 }
 
+// isJSONFile reports whether the file holds a library written by the dump command rather than
+// an iTunes plist. The file is left positioned at its start.
+func isJSONFile(file *os.File) bool {
+	reader := bufio.NewReader(file)
+	defer file.Seek(0, io.SeekStart)
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return false
+		}
+		if !unicode.IsSpace(rune(b)) {
+			return b == '{'
+		}
+	}
+}
+
 func (playlist *Playlist) Tracks(library *Library) []Track {
 	var tracks []Track
 	for _, item := range playlist.PlaylistItems {
@@ -145,3 +179,15 @@ func (playlist *Playlist) Tracks(library *Library) []Track {
 	}
 	return tracks
 }
+
+// sortedLibraryTracks returns all tracks of the library ordered by track id.
+func sortedLibraryTracks(library *Library) []Track {
+	tracks := make([]Track, 0, len(library.Tracks))
+	for _, track := range library.Tracks {
+		tracks = append(tracks, track)
+	}
+	sort.Slice(tracks, func(i, j int) bool {
+		return tracks[i].TrackId < tracks[j].TrackId
+	})
+	return tracks
+}
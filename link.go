@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	LINK_COPY = iota
+	LINK_HARDLINK
+	LINK_SYMLINK
+	LINK_REFLINK
+	LINK_AUTO
+)
+
+// copyOptions controls how copyFile creates a copy.
+type copyOptions struct {
+	// linkMode is one of the LINK_ constants. Links that cannot be made fall back to copying.
+	linkMode int
+	// manifest, if not nil, is used to verify copies and record their checksums.
+	manifest *Manifest
+	// prepare, if not nil, is called with the path of a new copy before it is moved into place.
+	prepare func(string) error
+	// fileMode and dirMode are the permissions of new copies and folders. Zero selects the defaults.
+	fileMode os.FileMode
+	dirMode  os.FileMode
+	// modTime, if not nil, returns the modification time of a new copy from the source file's info.
+	modTime func(os.FileInfo) time.Time
+	// xattrs selects whether the extended attributes of the source file are copied.
+	xattrs bool
+}
+
+// linkFile creates dest as a hard or symbolic link to src, as selected by linkMode.
+// Creating a link is atomic, so unlike a copy it needs no temporary file.
+func linkFile(src string, dest string, linkMode int) error {
+	switch linkMode {
+	case LINK_HARDLINK:
+		return os.Link(src, dest)
+	case LINK_SYMLINK:
+		target, err := filepath.Abs(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, dest)
+	default:
+		return fmt.Errorf("unable to link with link mode %v", linkMode)
+	}
+}
+
+// linkModeName returns the flag value of linkMode, for messages.
+func linkModeName(linkMode int) string {
+	switch linkMode {
+	case LINK_HARDLINK:
+		return "hardlink"
+	case LINK_SYMLINK:
+		return "symlink"
+	case LINK_REFLINK:
+		return "reflink"
+	case LINK_AUTO:
+		return "auto"
+	default:
+		return "copy"
+	}
+}
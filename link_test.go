@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyFileLinkModes(t *testing.T) {
+	outputDir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(outputDir)
+	src := filepath.Join(outputDir, "song.mp3")
+	writeFile(t, src, FileContent)
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag := func(path string) error { return nil }
+
+	tests := []struct {
+		name    string
+		options copyOptions
+		linked  bool
+		symlink bool
+	}{
+		{"copy", copyOptions{linkMode: LINK_COPY}, false, false},
+		{"hardlink", copyOptions{linkMode: LINK_HARDLINK}, true, false},
+		{"symlink", copyOptions{linkMode: LINK_SYMLINK}, true, true},
+		{"reflink", copyOptions{linkMode: LINK_REFLINK}, false, false},
+		{"auto", copyOptions{linkMode: LINK_AUTO}, true, false},
+		{"auto tagged", copyOptions{linkMode: LINK_AUTO, prepare: tag}, false, false},
+	}
+	for _, test := range tests {
+		dest := filepath.Join(outputDir, test.name, "song.mp3")
+		copied, err := copyFile(context.Background(), src, dest, test.options)
+		if err != nil || !copied {
+			t.Fatalf("%v: expected a copy, got %v, %v", test.name, copied, err)
+		}
+
+		if readFile(t, dest) != FileContent {
+			t.Errorf("%v: expected the content of the source", test.name)
+		}
+		destInfo, err := os.Stat(dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if os.SameFile(srcInfo, destInfo) != test.linked {
+			t.Errorf("%v: expected linked to be %v", test.name, test.linked)
+		}
+		linkInfo, err := os.Lstat(dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (linkInfo.Mode()&os.ModeSymlink != 0) != test.symlink {
+			t.Errorf("%v: expected symlink to be %v", test.name, test.symlink)
+		}
+	}
+}
+
+func TestCopyFileRecordsLinksInManifest(t *testing.T) {
+	outputDir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(outputDir)
+	src := filepath.Join(outputDir, "song.mp3")
+	writeFile(t, src, FileContent)
+	srcSum, err := fileChecksum(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := loadManifest(outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, linkMode := range []int{LINK_HARDLINK, LINK_SYMLINK} {
+		dest := filepath.Join(outputDir, linkModeName(linkMode), "song.mp3")
+		if _, err = copyFile(context.Background(), src, dest, copyOptions{linkMode: linkMode, manifest: manifest}); err != nil {
+			t.Fatal(err)
+		}
+		if entry, ok := manifest.Get(dest); !ok || entry != srcSum {
+			t.Errorf("%v: expected the link in the manifest with the source checksum, found %v", linkModeName(linkMode), entry)
+		}
+	}
+	if problems := verifyManifest(manifest); len(problems) != 0 {
+		t.Errorf("expected no problems, found %v", problems)
+	}
+}
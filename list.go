@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// PlaylistListing describes a playlist or folder, with the playlists inside a folder as its children.
+type PlaylistListing struct {
+	Name              string            `json:"name"`
+	PersistentId      string            `json:"persistentId"`
+	DistinguishedKind int               `json:"distinguishedKind"`
+	Master            bool              `json:"master,omitempty"`
+	Smart             bool              `json:"smart"`
+	Folder            bool              `json:"folder"`
+	IncludeAll        bool              `json:"includeAll"`
+	Tracks            int               `json:"tracks"`
+	TotalTime         int               `json:"totalTime"`
+	Children          []PlaylistListing `json:"children,omitempty"`
+}
+
+// listCommand lists the playlists of the library as a tree, or the tracks of the library or a playlist.
+func listCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: list playlists|tracks [<flags>]")
+	}
+	switch args[0] {
+	case "playlists":
+		return listPlaylistsCommand(args[1:])
+	case "tracks":
+		return tracksCommand(args[1:])
+	default:
+		return errors.New("Unknown List: " + args[0])
+	}
+}
+
+func listPlaylistsCommand(args []string) error {
+	var libraryPath, format, output string
+	flags := newCommandFlags("list playlists", &libraryPath)
+	flags.StringVar(&format, "format", "text", "")
+	flags.StringVar(&output, "output", "", "")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	format = strings.ToLower(format)
+	if format != "text" && format != "json" {
+		return errors.New("Unknown Format: " + format)
+	}
+
+	library, err := loadCommandLibrary(libraryPath)
+	if err != nil {
+		return err
+	}
+	listings := buildPlaylistListings(library)
+
+	w, closeOutput, err := commandOutput(output)
+	if err != nil {
+		return err
+	}
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(listings)
+	} else {
+		err = writePlaylistListingsText(w, listings)
+	}
+	if closeErr := closeOutput(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// buildPlaylistListings returns the tree of playlists and folders, built from ParentPersistentId, in
+// library order. A folder counts the distinct tracks of all the playlists inside it.
+func buildPlaylistListings(library *Library) []PlaylistListing {
+	children := make(map[string][]Playlist)
+	var roots []Playlist
+	for _, playlist := range library.Playlists {
+		if _, ok := library.PlaylistIdMap[playlist.ParentPersistentId]; ok && playlist.ParentPersistentId != playlist.PlaylistPersistentId {
+			children[playlist.ParentPersistentId] = append(children[playlist.ParentPersistentId], playlist)
+		} else {
+			roots = append(roots, playlist)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var build func(playlists []Playlist) []PlaylistListing
+	build = func(playlists []Playlist) []PlaylistListing {
+		var listings []PlaylistListing
+		for _, playlist := range playlists {
+			merged := playlist
+			if playlist.Folder {
+				merged = mergeFolder(playlist, library)
+			}
+			listing := PlaylistListing{
+				Name:              playlist.Name,
+				PersistentId:      playlist.PlaylistPersistentId,
+				DistinguishedKind: playlist.DistinguishedKind,
+				Master:            playlist.Master,
+				Smart:             len(playlist.SmartInfo) > 0 || len(playlist.SmartCriteria) > 0,
+				Folder:            playlist.Folder,
+				IncludeAll:        playlist.IncludedByIncludeAll(),
+				Tracks:            len(merged.PlaylistItems),
+			}
+			for _, track := range merged.Tracks(library) {
+				listing.TotalTime += track.TotalTime
+			}
+			if id := playlist.PlaylistPersistentId; id != "" && !seen[id] {
+				seen[id] = true
+				listing.Children = build(children[id])
+			}
+			listings = append(listings, listing)
+		}
+		return listings
+	}
+	return build(roots)
+}
+
+// writePlaylistListingsText writes the tree of playlists, one per line, indented below their folders.
+func writePlaylistListingsText(w io.Writer, listings []PlaylistListing) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Name\tPersistent ID\tKind\tTracks\tDuration\n")
+	var write func(listings []PlaylistListing, depth int)
+	write = func(listings []PlaylistListing, depth int) {
+		for _, listing := range listings {
+			fmt.Fprintf(tw, "%v%v\t%v\t%v\t%v\t%v\n", strings.Repeat("  ", depth), listing.Name, listing.PersistentId,
+				playlistKindDescription(listing), listing.Tracks, formatDuration(listing.TotalTime))
+			write(listing.Children, depth+1)
+		}
+	}
+	write(listings, 0)
+	fmt.Fprintf(tw, "\nPlaylists marked builtin or master are only exported with -includeAllWithBuiltin, not -includeAll.\n")
+	return tw.Flush()
+}
+
+// playlistKindDescription describes the flags of a playlist, e.g. "folder" or "builtin 4, smart".
+func playlistKindDescription(listing PlaylistListing) string {
+	var flags []string
+	if listing.Master {
+		flags = append(flags, "master")
+	} else if !listing.IncludeAll {
+		flags = append(flags, fmt.Sprintf("builtin %v", listing.DistinguishedKind))
+	}
+	if listing.Folder {
+		flags = append(flags, "folder")
+	}
+	if listing.Smart {
+		flags = append(flags, "smart")
+	}
+	if len(flags) == 0 {
+		return "-"
+	}
+	return strings.Join(flags, ", ")
+}
+
+// formatDuration formats a time in milliseconds as hours, minutes and seconds.
+func formatDuration(ms int) string {
+	seconds := ms / 1000
+	return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
+
+// findListPlaylist returns the playlist with the name, or the one playlist matching the selector, e.g.
+// id:<persistent id> or folder:<path>. A folder is returned as the playlist of the tracks inside it.
+func findListPlaylist(library *Library, text string) (Playlist, error) {
+	playlist, ok := library.PlaylistMap[text]
+	if !ok {
+		selector, err := parsePlaylistSelector(text, false)
+		if err != nil {
+			return Playlist{}, err
+		}
+		var matches []Playlist
+		for _, p := range library.Playlists {
+			if selector.matchesPlaylist(p, library) {
+				matches = append(matches, p)
+			}
+		}
+		switch len(matches) {
+		case 0:
+			return Playlist{}, fmt.Errorf("unable to find playlist %q", text)
+		case 1:
+			playlist = matches[0]
+		default:
+			return Playlist{}, fmt.Errorf("%v playlists match %q, select one with id:<persistent id>", len(matches), text)
+		}
+	}
+	if playlist.Folder {
+		playlist = mergeFolder(playlist, library)
+	}
+	return playlist, nil
+}
+
+func writeTracksText(w io.Writer, columns []trackColumn, tracks []Track) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(columnNames(columns), "\t"))
+	for _, track := range tracks {
+		location, _ := locationPath(track.Location)
+		fmt.Fprintln(tw, strings.Join(columnValues(columns, &track, location), "\t"))
+	}
+	return tw.Flush()
+}
+
+func writeTracksJSON(w io.Writer, columns []trackColumn, tracks []Track) error {
+	rows := make([]map[string]string, 0, len(tracks))
+	for _, track := range tracks {
+		location, _ := locationPath(track.Location)
+		row := make(map[string]string)
+		for i, value := range columnValues(columns, &track, location) {
+			row[columns[i].name] = value
+		}
+		rows = append(rows, row)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(rows)
+}
+
+// writeTracksDelimited writes the tracks as CSV or TSV, with a header row naming the columns.
+func writeTracksDelimited(w io.Writer, comma rune, columns []trackColumn, tracks []Track) error {
+	writer := csv.NewWriter(w)
+	writer.Comma = comma
+	writer.Write(columnNames(columns))
+	for _, track := range tracks {
+		location, _ := locationPath(track.Location)
+		writer.Write(columnValues(columns, &track, location))
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func listTestLibrary() *Library {
+	library := &Library{
+		Tracks: map[string]Track{
+			"1": {TrackId: 1, Name: "One", Artist: "A", TotalTime: 60000, Location: "file:///music/1.mp3"},
+			"2": {TrackId: 2, Name: "Two", Artist: "B", TotalTime: 3600000, Location: "file:///music/2.mp3"},
+		},
+		Playlists: []Playlist{
+			{Name: "Library", PlaylistPersistentId: "L1", Master: true, PlaylistItems: []PlaylistItem{{1}, {2}}},
+			{Name: "Music", PlaylistPersistentId: "B1", DistinguishedKind: 4, SmartInfo: []byte{1}, PlaylistItems: []PlaylistItem{{1}, {2}}},
+			{Name: "Workouts", PlaylistPersistentId: "F1", Folder: true},
+			{Name: "Run", PlaylistPersistentId: "P1", ParentPersistentId: "F1", PlaylistItems: []PlaylistItem{{1}, {2}}},
+			{Name: "Walk", PlaylistPersistentId: "P2", ParentPersistentId: "F1", PlaylistItems: []PlaylistItem{{2}}},
+			{Name: "Walk", PlaylistPersistentId: "P3"},
+		},
+	}
+	library.PlaylistMap = make(map[string]Playlist)
+	library.PlaylistIdMap = make(map[string]Playlist)
+	for _, playlist := range library.Playlists {
+		library.PlaylistMap[playlist.Name] = playlist
+		library.PlaylistIdMap[playlist.PlaylistPersistentId] = playlist
+	}
+	return library
+}
+
+func TestBuildPlaylistListings(t *testing.T) {
+	listings := buildPlaylistListings(listTestLibrary())
+
+	if len(listings) != 4 {
+		t.Fatalf("expected 4 top level playlists, got %+v", listings)
+	}
+	folder := listings[2]
+	if folder.Name != "Workouts" || !folder.Folder || folder.Tracks != 2 || folder.TotalTime != 3660000 || len(folder.Children) != 2 {
+		t.Errorf("unexpected folder %+v", folder)
+	}
+	if listings[0].IncludeAll || listings[1].IncludeAll || !folder.IncludeAll || !listings[1].Smart {
+		t.Errorf("unexpected flags %+v", listings)
+	}
+
+	b := &strings.Builder{}
+	if err := writePlaylistListingsText(b, listings); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"Library   L1             master            2       1:01:00",
+		"Music     B1             builtin 4, smart  2       1:01:00",
+		"Workouts  F1             folder            2       1:01:00",
+		"  Run     P1             -                 2       1:01:00",
+		"  Walk    P2             -                 1       1:00:00",
+	} {
+		if !strings.Contains(b.String(), expected+"\n") {
+			t.Errorf("expected %q in\n%v", expected, b.String())
+		}
+	}
+}
+
+func TestFindListPlaylist(t *testing.T) {
+	library := listTestLibrary()
+
+	playlist, err := findListPlaylist(library, "folder:Workouts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if playlist.Folder || len(playlist.PlaylistItems) != 2 {
+		t.Errorf("expected the folder as a merged playlist, got %+v", playlist)
+	}
+	if playlist, err = findListPlaylist(library, "id:P2"); err != nil || playlist.ParentPersistentId != "F1" {
+		t.Errorf("expected the playlist with the id, got %+v %v", playlist, err)
+	}
+	if _, err = findListPlaylist(library, "W*"); err == nil {
+		t.Error("expected an error for a pattern matching several playlists")
+	}
+	if _, err = findListPlaylist(library, "Missing"); err == nil {
+		t.Error("expected an error for a missing playlist")
+	}
+}
+
+func TestWriteTracksJSON(t *testing.T) {
+	library := listTestLibrary()
+	columns, err := parseColumns("name,time,location")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run := library.PlaylistMap["Run"]
+	b := &strings.Builder{}
+	if err = writeTracksJSON(b, columns, run.Tracks(library)); err != nil {
+		t.Fatal(err)
+	}
+	var rows []map[string]string
+	if err = json.Unmarshal([]byte(b.String()), &rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[1]["name"] != "Two" || rows[1]["time"] != "60:00" || rows[1]["location"] != "/music/2.mp3" {
+		t.Errorf("unexpected rows %v", rows)
+	}
+}
+
+func TestListCommandUnknownList(t *testing.T) {
+	if err := listCommand([]string{"albums"}); err == nil || err.Error() != "Unknown List: albums" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"runtime"
+	"strings"
+)
+
+// The operating systems a library can come from, and -targetOS can write paths for.
+const (
+	OS_UNKNOWN = ""
+	OS_WINDOWS = "windows"
+	OS_MAC     = "darwin"
+	OS_LINUX   = "linux"
+)
+
+// locationPath converts a track location from the library, a file:// URL, into a file path.
+// The path is in the style of the system the library comes from, with / as the separator:
+// file://localhost/C:/Music/a.mp3 becomes C:/Music/a.mp3, file://server/share/a.mp3 becomes the UNC
+// path //server/share/a.mp3 and file://localhost/Volumes/Music/a.mp3 becomes /Volumes/Music/a.mp3.
+// Locations that are not file URLs, e.g. of streamed tracks, are returned unchanged.
+func locationPath(location string) (string, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return location, err
+	}
+	if !strings.EqualFold(u.Scheme, "file") {
+		return location, nil
+	}
+	if u.Opaque != "" {
+		// file:C:/Music/a.mp3
+		return url.PathUnescape(u.Opaque)
+	}
+
+	path := u.Path
+	if isDrivePath(strings.TrimPrefix(path, "/")) {
+		return strings.TrimPrefix(path, "/"), nil
+	}
+	if u.Host != "" && !strings.EqualFold(u.Host, "localhost") {
+		return "//" + u.Host + path, nil
+	}
+	return path, nil
+}
+
+// isDrivePath reports whether path starts with a Windows drive letter, e.g. C:/
+func isDrivePath(path string) bool {
+	return len(path) >= 2 && path[1] == ':' &&
+		('a' <= path[0] && path[0] <= 'z' || 'A' <= path[0] && path[0] <= 'Z') &&
+		(len(path) == 2 || path[2] == '/' || path[2] == '\\')
+}
+
+// pathOrigin returns the operating system a path in the style of locationPath comes from,
+// or OS_UNKNOWN if it could come from any Unix.
+func pathOrigin(path string) string {
+	switch {
+	case isDrivePath(path) || strings.HasPrefix(path, "//") || strings.HasPrefix(path, `\\`):
+		return OS_WINDOWS
+	case strings.HasPrefix(path, "/Volumes/") || strings.HasPrefix(path, "/Users/"):
+		return OS_MAC
+	default:
+		return OS_UNKNOWN
+	}
+}
+
+// libraryOrigin returns the operating system the library was created on, from its music folder or,
+// if that is not conclusive, from the first track with a recognizable location.
+func libraryOrigin(library *Library) string {
+	if path, err := locationPath(library.MusicFolder); err == nil && pathOrigin(path) != OS_UNKNOWN {
+		return pathOrigin(path)
+	}
+	for _, track := range sortedLibraryTracks(library) {
+		if path, err := locationPath(track.Location); err == nil && pathOrigin(path) != OS_UNKNOWN {
+			return pathOrigin(path)
+		}
+	}
+	return OS_UNKNOWN
+}
+
+// parseTargetOS returns the operating system named by -targetOS, the current one if name is empty.
+func parseTargetOS(name string) (string, error) {
+	switch strings.ToLower(name) {
+	case "":
+		return parseTargetOS(runtime.GOOS)
+	case "windows":
+		return OS_WINDOWS, nil
+	case "mac", "macos", "darwin":
+		return OS_MAC, nil
+	case "linux":
+		return OS_LINUX, nil
+	default:
+		return "", errors.New("Unknown Target OS: " + name)
+	}
+}
+
+// targetPathSeparator returns the path separator of the target operating system.
+func targetPathSeparator(targetOS string) string {
+	if targetOS == OS_WINDOWS {
+		return `\`
+	}
+	return "/"
+}
+
+// originWarning describes why the paths of a library from origin will not work on targetOS,
+// unless they are rewritten. It returns an empty string if they should work.
+func originWarning(origin string, targetOS string) string {
+	switch {
+	case origin == OS_WINDOWS && targetOS != OS_WINDOWS:
+		return fmt.Sprintf("The library comes from Windows, its drive letter and UNC paths will not work on %v. "+
+			"Use -rewrite or -musicPath to map them.", targetOS)
+	case origin == OS_MAC && targetOS == OS_WINDOWS:
+		return "The library comes from macOS, its paths will not work on Windows. " +
+			"Use -rewrite or -musicPath to map them."
+	default:
+		return ""
+	}
+}
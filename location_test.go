@@ -0,0 +1,66 @@
+package main
+
+import "testing"
+
+func TestLocationPath(t *testing.T) {
+	tests := []struct {
+		location string
+		expected string
+		origin   string
+	}{
+		{"file://localhost/Users/me/Music/My%20Song.mp3", "/Users/me/Music/My Song.mp3", OS_MAC},
+		{"file://localhost/Volumes/Music/A+B.mp3", "/Volumes/Music/A+B.mp3", OS_MAC},
+		{"file://localhost/C:/Users/me/Music/song.mp3", "C:/Users/me/Music/song.mp3", OS_WINDOWS},
+		{"file:///D:/iTunes/song.mp3", "D:/iTunes/song.mp3", OS_WINDOWS},
+		{"file://nas/music/song.mp3", "//nas/music/song.mp3", OS_WINDOWS},
+		{"file:///home/me/music/song.mp3", "/home/me/music/song.mp3", OS_UNKNOWN},
+		{"http://example.com/podcast.mp3", "http://example.com/podcast.mp3", OS_UNKNOWN},
+		{"/plain/path/song.mp3", "/plain/path/song.mp3", OS_UNKNOWN},
+	}
+	for _, test := range tests {
+		path, err := locationPath(test.location)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if path != test.expected {
+			t.Errorf("%v: expected %v, got %v", test.location, test.expected, path)
+		}
+		if origin := pathOrigin(path); origin != test.origin {
+			t.Errorf("%v: expected origin %q, got %q", test.location, test.origin, origin)
+		}
+	}
+}
+
+func TestLibraryOrigin(t *testing.T) {
+	library := &Library{
+		MusicFolder: "file://localhost/C:/Users/me/Music/iTunes/iTunes%20Media/",
+	}
+	if origin := libraryOrigin(library); origin != OS_WINDOWS {
+		t.Errorf("expected a Windows library, got %q", origin)
+	}
+	if originWarning(OS_WINDOWS, OS_LINUX) == "" || originWarning(OS_WINDOWS, OS_WINDOWS) != "" {
+		t.Error("expected a warning only for Windows paths on another operating system")
+	}
+
+	library = &Library{Tracks: map[string]Track{
+		"1": {TrackId: 1, Location: "file://localhost/Volumes/Music/song.mp3"},
+	}}
+	if origin := libraryOrigin(library); origin != OS_MAC {
+		t.Errorf("expected a macOS library, got %q", origin)
+	}
+}
+
+func TestParseTargetOS(t *testing.T) {
+	for name, expected := range map[string]string{"Windows": OS_WINDOWS, "mac": OS_MAC, "linux": OS_LINUX} {
+		targetOS, err := parseTargetOS(name)
+		if err != nil || targetOS != expected {
+			t.Errorf("%v: expected %v, got %v, %v", name, expected, targetOS, err)
+		}
+	}
+	if _, err := parseTargetOS("beos"); err == nil {
+		t.Error("expected an error for an unknown operating system")
+	}
+	if targetPathSeparator(OS_WINDOWS) != `\` || targetPathSeparator(OS_LINUX) != "/" {
+		t.Error("expected the path separator of the target operating system")
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// MP4 atom types that only contain other atoms and are walked when rewriting the metadata.
+var mp4ContainerAtoms = map[string]bool{
+	"moov": true, "trak": true, "mdia": true, "minf": true, "stbl": true, "udta": true, "ilst": true, "----": true,
+}
+
+var mp4ItemAtoms = map[string]string{
+	"name":        "\xa9nam",
+	"artist":      "\xa9ART",
+	"albumartist": "aART",
+	"album":       "\xa9alb",
+	"genre":       "\xa9gen",
+	"comments":    "\xa9cmt",
+	"grouping":    "\xa9grp",
+	"work":        "\xa9wrk",
+}
+
+// Fields without a standard ilst atom are written as iTunes freeform (----) atoms.
+var mp4FreeformNames = map[string]string{
+	"rating":    "RATING",
+	"playcount": "PLAY_COUNT",
+}
+
+const mp4FreeformMean = "com.apple.iTunes"
+
+var errFragmentedMP4 = errors.New("fragmented MP4 files are not tagged")
+
+type mp4Atom struct {
+	kind      string
+	largeSize bool   // the atom has a 64-bit size, which is kept when it is written again
+	data      []byte // payload of leaf atoms, or the version and flags of the meta atom
+	children  []*mp4Atom
+}
+
+type mp4TopLevelAtom struct {
+	kind   string
+	offset int64
+	size   int64
+}
+
+// writeMP4Tags rewrites the ilst metadata of the MP4 file at dest. When the moov atom has to grow and
+// precedes the media data, the chunk offsets are shifted so the audio data is still found.
+// Fragmented MP4 files are not tagged, as the offsets in their movie fragments are not shifted.
+func writeMP4Tags(dest string, values map[string]string) error {
+	in, err := os.Open(dest)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	atoms, err := readMP4TopLevelAtoms(in, info.Size())
+	if err != nil {
+		return err
+	}
+
+	var moov *mp4TopLevelAtom
+	for i := range atoms {
+		switch atoms[i].kind {
+		case "moov":
+			moov = &atoms[i]
+		case "moof":
+			return errFragmentedMP4
+		}
+	}
+	if moov == nil {
+		return errors.New("no moov atom found")
+	}
+
+	moovData := make([]byte, moov.size)
+	if _, err = in.ReadAt(moovData, moov.offset); err != nil {
+		return err
+	}
+	root, err := parseMP4Atom(moovData)
+	if err != nil {
+		return err
+	}
+	if root.child("mvex") != nil {
+		return errFragmentedMP4
+	}
+
+	setMP4Items(mp4Ilst(root), values)
+
+	newMoov := root.marshal()
+	delta := int64(len(newMoov)) - moov.size
+	if delta != 0 {
+		shiftMP4ChunkOffsets(root, moov.offset, delta)
+		newMoov = root.marshal()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".tags-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	for _, atom := range atoms {
+		if atom.kind == "moov" {
+			_, err = tmp.Write(newMoov)
+		} else {
+			_, err = io.Copy(tmp, io.NewSectionReader(in, atom.offset, atom.size))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err = tmp.Chmod(info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	in.Close()
+	return os.Rename(tmp.Name(), dest)
+}
+
+func readMP4TopLevelAtoms(r io.ReaderAt, fileSize int64) ([]mp4TopLevelAtom, error) {
+	var atoms []mp4TopLevelAtom
+	header := make([]byte, 16)
+	for offset := int64(0); offset < fileSize; {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return nil, err
+		}
+		size := int64(binary.BigEndian.Uint32(header))
+		switch size {
+		case 0:
+			size = fileSize - offset
+		case 1:
+			if _, err := r.ReadAt(header[8:], offset+8); err != nil {
+				return nil, err
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:]))
+		}
+		if size < 8 || offset+size > fileSize {
+			return nil, errors.New("invalid MP4 atom size")
+		}
+		atoms = append(atoms, mp4TopLevelAtom{kind: string(header[4:8]), offset: offset, size: size})
+		offset += size
+	}
+	return atoms, nil
+}
+
+func parseMP4Atom(b []byte) (*mp4Atom, error) {
+	if len(b) < 8 {
+		return nil, errors.New("truncated MP4 atom")
+	}
+	headerSize := 8
+	if binary.BigEndian.Uint32(b) == 1 {
+		headerSize = 16
+	}
+	atom := &mp4Atom{kind: string(b[4:8]), largeSize: headerSize == 16}
+	payload := b[headerSize:]
+
+	if atom.kind == "meta" && len(payload) >= 8 && string(payload[4:8]) != "hdlr" {
+		// The iTunes meta atom is a full atom, with version and flags ahead of its children.
+		atom.data = payload[:4]
+		payload = payload[4:]
+	} else if !mp4ContainerAtoms[atom.kind] {
+		atom.data = payload
+		return atom, nil
+	}
+
+	for len(payload) > 0 {
+		if len(payload) < 8 {
+			return nil, errors.New("truncated MP4 atom")
+		}
+		size := uint64(binary.BigEndian.Uint32(payload))
+		if size == 1 && len(payload) >= 16 {
+			size = binary.BigEndian.Uint64(payload[8:])
+		}
+		if size < 8 || size > uint64(len(payload)) {
+			return nil, errors.New("invalid MP4 atom size")
+		}
+		child, err := parseMP4Atom(payload[:size])
+		if err != nil {
+			return nil, err
+		}
+		atom.children = append(atom.children, child)
+		payload = payload[size:]
+	}
+	return atom, nil
+}
+
+func (a *mp4Atom) marshal() []byte {
+	payload := append([]byte{}, a.data...)
+	for _, child := range a.children {
+		payload = append(payload, child.marshal()...)
+	}
+	if a.largeSize || 8+int64(len(payload)) > math.MaxUint32 {
+		b := make([]byte, 16, 16+len(payload))
+		binary.BigEndian.PutUint32(b, 1)
+		copy(b[4:], a.kind)
+		binary.BigEndian.PutUint64(b[8:], uint64(16+len(payload)))
+		return append(b, payload...)
+	}
+	b := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(b, uint32(8+len(payload)))
+	copy(b[4:], a.kind)
+	return append(b, payload...)
+}
+
+func (a *mp4Atom) child(kind string) *mp4Atom {
+	for _, child := range a.children {
+		if child.kind == kind {
+			return child
+		}
+	}
+	return nil
+}
+
+// mp4Ilst returns the moov/udta/meta/ilst atom, creating any missing atoms along the way.
+func mp4Ilst(moov *mp4Atom) *mp4Atom {
+	udta := moov.child("udta")
+	if udta == nil {
+		udta = &mp4Atom{kind: "udta"}
+		moov.children = append(moov.children, udta)
+	}
+	meta := udta.child("meta")
+	if meta == nil {
+		hdlr := make([]byte, 25)
+		copy(hdlr[8:], "mdirappl")
+		meta = &mp4Atom{kind: "meta", data: make([]byte, 4), children: []*mp4Atom{{kind: "hdlr", data: hdlr}}}
+		udta.children = append(udta.children, meta)
+	}
+	ilst := meta.child("ilst")
+	if ilst == nil {
+		ilst = &mp4Atom{kind: "ilst"}
+		meta.children = append(meta.children, ilst)
+	}
+	return ilst
+}
+
+// setMP4Items replaces or adds an ilst item for each of the values.
+func setMP4Items(ilst *mp4Atom, values map[string]string) {
+	for field, value := range values {
+		var item *mp4Atom
+		if kind, ok := mp4ItemAtoms[field]; ok {
+			item = &mp4Atom{kind: kind, children: []*mp4Atom{mp4TextData(value)}}
+		} else if name, ok := mp4FreeformNames[field]; ok {
+			item = &mp4Atom{kind: "----", children: []*mp4Atom{
+				{kind: "mean", data: append(make([]byte, 4), mp4FreeformMean...)},
+				{kind: "name", data: append(make([]byte, 4), name...)},
+				mp4TextData(value),
+			}}
+		} else {
+			continue
+		}
+
+		var kept []*mp4Atom
+		for _, existing := range ilst.children {
+			if !sameMP4Item(existing, item) {
+				kept = append(kept, existing)
+			}
+		}
+		ilst.children = append(kept, item)
+	}
+}
+
+func sameMP4Item(a, b *mp4Atom) bool {
+	if a.kind != b.kind {
+		return false
+	}
+	if a.kind != "----" {
+		return true
+	}
+	aName, bName := a.child("name"), b.child("name")
+	return aName != nil && bName != nil && string(aName.data) == string(bName.data)
+}
+
+// mp4TextData returns a data atom holding a UTF-8 string.
+func mp4TextData(value string) *mp4Atom {
+	data := make([]byte, 8, 8+len(value))
+	data[3] = 1 // UTF-8
+	return &mp4Atom{kind: "data", data: append(data, value...)}
+}
+
+// shiftMP4ChunkOffsets adds delta to every stco and co64 chunk offset that points past the moov atom.
+func shiftMP4ChunkOffsets(atom *mp4Atom, moovOffset int64, delta int64) {
+	switch atom.kind {
+	case "stco":
+		if len(atom.data) < 8 {
+			return
+		}
+		count := int(binary.BigEndian.Uint32(atom.data[4:]))
+		for i := 0; i < count && 8+i*4+4 <= len(atom.data); i++ {
+			entry := atom.data[8+i*4:]
+			offset := int64(binary.BigEndian.Uint32(entry))
+			if offset > moovOffset {
+				binary.BigEndian.PutUint32(entry, uint32(offset+delta))
+			}
+		}
+	case "co64":
+		if len(atom.data) < 8 {
+			return
+		}
+		count := int(binary.BigEndian.Uint32(atom.data[4:]))
+		for i := 0; i < count && 8+i*8+8 <= len(atom.data); i++ {
+			entry := atom.data[8+i*8:]
+			offset := int64(binary.BigEndian.Uint64(entry))
+			if offset > moovOffset {
+				binary.BigEndian.PutUint64(entry, uint64(offset+delta))
+			}
+		}
+	}
+	for _, child := range atom.children {
+		shiftMP4ChunkOffsets(child, moovOffset, delta)
+	}
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// The results of the interactive picker.
+const (
+	PICK_NONE = iota
+	PICK_EXPORT
+	PICK_PRINT
+	PICK_QUIT
+)
+
+const pickerHelp = "↑/↓ move  →/← open/close folder  space select  / search  enter export  p print command  q quit"
+
+// pickerNode is a playlist or folder in the tree of the interactive picker.
+type pickerNode struct {
+	playlist Playlist
+	path     string
+	depth    int
+	parent   *pickerNode
+	children []*pickerNode
+	tracks   int
+	expanded bool
+	selected bool
+}
+
+// picker is the state of the interactive playlist picker, independent of the terminal.
+type picker struct {
+	library   *Library
+	roots     []*pickerNode
+	nodes     []*pickerNode
+	cursor    int
+	offset    int
+	query     string
+	searching bool
+	names     map[string]int
+}
+
+// newPicker builds the tree of folders and playlists from ParentPersistentId, in library order.
+// The master Library playlist is left out. The playlists in preselected start selected.
+func newPicker(library *Library, preselected []Playlist) *picker {
+	p := &picker{library: library, names: make(map[string]int)}
+	byId := make(map[string]*pickerNode)
+	for _, playlist := range library.Playlists {
+		p.names[playlist.Name]++
+		if playlist.Master || playlist.DistinguishedKind == 0 && playlist.Name == "Library" {
+			continue
+		}
+		tracks := len(playlist.PlaylistItems)
+		if playlist.Folder {
+			tracks = len(mergeFolder(playlist, library).PlaylistItems)
+		}
+		node := &pickerNode{playlist: playlist, tracks: tracks}
+		p.nodes = append(p.nodes, node)
+		if playlist.PlaylistPersistentId != "" {
+			byId[playlist.PlaylistPersistentId] = node
+		}
+	}
+
+	for _, node := range p.nodes {
+		if parent, ok := byId[node.playlist.ParentPersistentId]; ok && parent != node {
+			node.parent = parent
+			parent.children = append(parent.children, node)
+		} else {
+			p.roots = append(p.roots, node)
+		}
+	}
+	var setDepth func(nodes []*pickerNode, depth int, path string)
+	setDepth = func(nodes []*pickerNode, depth int, path string) {
+		for _, node := range nodes {
+			node.depth = depth
+			node.path = path
+			setDepth(node.children, depth+1, path+node.playlist.Name+"/")
+		}
+	}
+	setDepth(p.roots, 0, "")
+
+	selected := make(map[string]bool)
+	for _, playlist := range preselected {
+		selected[playlist.PlaylistPersistentId] = true
+	}
+	for _, node := range p.nodes {
+		if selected[node.playlist.PlaylistPersistentId] && node.playlist.PlaylistPersistentId != "" && !node.inSelectedFolder() {
+			node.selected = true
+		}
+	}
+	return p
+}
+
+// inSelectedFolder reports whether one of the folders the node is in is selected.
+func (n *pickerNode) inSelectedFolder() bool {
+	for parent := n.parent; parent != nil; parent = parent.parent {
+		if parent.selected {
+			return true
+		}
+	}
+	return false
+}
+
+// visible returns the rows shown: the expanded tree or, while searching, every playlist whose name contains
+// the query.
+func (p *picker) visible() []*pickerNode {
+	var rows []*pickerNode
+	if p.query != "" {
+		query := strings.ToLower(p.query)
+		for _, node := range p.nodes {
+			if strings.Contains(strings.ToLower(node.playlist.Name), query) {
+				rows = append(rows, node)
+			}
+		}
+		return rows
+	}
+
+	var walk func(nodes []*pickerNode)
+	walk = func(nodes []*pickerNode) {
+		for _, node := range nodes {
+			rows = append(rows, node)
+			if node.expanded {
+				walk(node.children)
+			}
+		}
+	}
+	walk(p.roots)
+	return rows
+}
+
+// handleKey applies a key, as returned by parseKeys, and returns one of the PICK_ constants.
+func (p *picker) handleKey(key string) int {
+	rows := p.visible()
+	var current *pickerNode
+	if p.cursor < len(rows) {
+		current = rows[p.cursor]
+	}
+
+	if p.searching {
+		switch key {
+		case "enter":
+			p.searching = false
+		case "esc":
+			p.searching = false
+			p.query = ""
+		case "backspace":
+			if p.query != "" {
+				p.query = p.query[:len(p.query)-1]
+			}
+		case "up", "down":
+			p.move(key, len(rows))
+			return PICK_NONE
+		default:
+			if !isKeyName(key) {
+				p.query += key
+			}
+		}
+		p.cursor = 0
+		return PICK_NONE
+	}
+
+	switch key {
+	case "up", "k", "down", "j":
+		p.move(key, len(rows))
+	case "right", "l":
+		if current != nil && len(current.children) > 0 {
+			current.expanded = true
+		}
+	case "left", "h":
+		if current != nil && current.expanded {
+			current.expanded = false
+		} else if current != nil && current.parent != nil && p.query == "" {
+			for i, row := range rows {
+				if row == current.parent {
+					p.cursor = i
+				}
+			}
+		}
+	case " ":
+		if current != nil && !current.inSelectedFolder() {
+			current.selected = !current.selected
+			if current.selected {
+				current.clearDescendants()
+			}
+		}
+	case "/":
+		p.searching = true
+	case "enter":
+		return PICK_EXPORT
+	case "p":
+		return PICK_PRINT
+	case "esc":
+		if p.query != "" {
+			p.query = ""
+			p.cursor = 0
+			return PICK_NONE
+		}
+		return PICK_QUIT
+	case "q", "ctrl-c":
+		return PICK_QUIT
+	}
+	return PICK_NONE
+}
+
+func (p *picker) move(key string, rows int) {
+	if (key == "up" || key == "k") && p.cursor > 0 {
+		p.cursor--
+	} else if (key == "down" || key == "j") && p.cursor < rows-1 {
+		p.cursor++
+	}
+}
+
+// clearDescendants deselects the playlists in a selected folder, which are selected through it.
+func (n *pickerNode) clearDescendants() {
+	for _, child := range n.children {
+		child.selected = false
+		child.clearDescendants()
+	}
+}
+
+// render draws the picker into height lines.
+func (p *picker) render(w io.Writer, height int) {
+	rows := p.visible()
+	listHeight := height - 3
+	if listHeight < 1 {
+		listHeight = 1
+	}
+	if p.cursor < p.offset {
+		p.offset = p.cursor
+	} else if p.cursor >= p.offset+listHeight {
+		p.offset = p.cursor - listHeight + 1
+	}
+
+	b := &strings.Builder{}
+	b.WriteString("\x1b[H\x1b[2J")
+	fmt.Fprintf(b, "%v\r\n", pickerHelp)
+	for i := p.offset; i < len(rows) && i < p.offset+listHeight; i++ {
+		b.WriteString(p.renderRow(rows[i], i == p.cursor))
+		b.WriteString("\r\n")
+	}
+	for i := len(rows) - p.offset; i < listHeight; i++ {
+		b.WriteString("\r\n")
+	}
+	selectors := p.selectors()
+	if p.searching || p.query != "" {
+		fmt.Fprintf(b, "Search: %v", p.query)
+	} else {
+		fmt.Fprintf(b, "%v selected", len(selectors))
+	}
+	io.WriteString(w, b.String())
+}
+
+func (p *picker) renderRow(node *pickerNode, current bool) string {
+	b := &strings.Builder{}
+	if current {
+		b.WriteString("> ")
+	} else {
+		b.WriteString("  ")
+	}
+	switch {
+	case node.selected:
+		b.WriteString("[x] ")
+	case node.inSelectedFolder():
+		b.WriteString("[+] ")
+	default:
+		b.WriteString("[ ] ")
+	}
+
+	name := node.playlist.Name
+	if p.query != "" {
+		name = node.path + name
+	} else {
+		b.WriteString(strings.Repeat("  ", node.depth))
+	}
+	switch {
+	case node.playlist.Folder && node.expanded && p.query == "":
+		b.WriteString("▾ ")
+	case node.playlist.Folder:
+		b.WriteString("▸ ")
+	default:
+		b.WriteString("  ")
+	}
+	fmt.Fprintf(b, "%v (%v tracks)", name, node.tracks)
+	return b.String()
+}
+
+// selectors returns the include parameters selecting the chosen playlists and folders. Playlists are
+// selected by name when that is unambiguous, folders by their path, and everything else by persistent id.
+func (p *picker) selectors() []string {
+	var selectors []string
+	for _, node := range p.nodes {
+		if !node.selected {
+			continue
+		}
+		playlist := node.playlist
+		name := playlist.Name
+		switch {
+		case playlist.Folder && playlist.PlaylistPersistentId != "" && p.uniqueFolderPath(playlist):
+			selectors = append(selectors, FolderSelectorPrefix+folderPath(playlist, p.library))
+		case p.names[name] > 1 || p.library.PlaylistMap[name].PlaylistPersistentId != playlist.PlaylistPersistentId:
+			selectors = append(selectors, IdSelectorPrefix+playlist.PlaylistPersistentId)
+		case isSelectorSyntax(name):
+			selectors = append(selectors, NameSelectorPrefix+name)
+		default:
+			selectors = append(selectors, name)
+		}
+	}
+	return selectors
+}
+
+func (p *picker) uniqueFolderPath(folder Playlist) bool {
+	path := folderPath(folder, p.library)
+	for _, node := range p.nodes {
+		if node.playlist.Folder && node.playlist.PlaylistPersistentId != folder.PlaylistPersistentId && folderPath(node.playlist, p.library) == path {
+			return false
+		}
+	}
+	return true
+}
+
+// isSelectorSyntax reports whether a playlist name would not be read as that exact name by parsePlaylistSelector,
+// or as a parameter.
+func isSelectorSyntax(name string) bool {
+	for _, prefix := range []string{NameSelectorPrefix, GlobSelectorPrefix, RegexSelectorPrefix, FolderSelectorPrefix, IdSelectorPrefix} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return strings.ContainsAny(name, "*?[") || name == "include" || name == "exclude" || strings.HasPrefix(name, "-")
+}
+
+func isKeyName(key string) bool {
+	switch key {
+	case "up", "down", "left", "right", "enter", "esc", "backspace", "tab", "ctrl-c":
+		return true
+	}
+	return false
+}
+
+// parseKeys splits terminal input into keys: a single character, or the name of a special key.
+func parseKeys(input []byte) []string {
+	var keys []string
+	for len(input) > 0 {
+		switch {
+		case len(input) >= 3 && input[0] == 0x1b && (input[1] == '[' || input[1] == 'O'):
+			switch input[2] {
+			case 'A':
+				keys = append(keys, "up")
+			case 'B':
+				keys = append(keys, "down")
+			case 'C':
+				keys = append(keys, "right")
+			case 'D':
+				keys = append(keys, "left")
+			}
+			input = input[3:]
+		case input[0] == 0x1b:
+			keys = append(keys, "esc")
+			input = input[1:]
+		case input[0] == '\r' || input[0] == '\n':
+			keys = append(keys, "enter")
+			input = input[1:]
+		case input[0] == 0x7f || input[0] == 0x08:
+			keys = append(keys, "backspace")
+			input = input[1:]
+		case input[0] == 0x03:
+			keys = append(keys, "ctrl-c")
+			input = input[1:]
+		case input[0] == '\t':
+			keys = append(keys, "tab")
+			input = input[1:]
+		default:
+			r := []rune(string(input))
+			if len(r) == 0 {
+				return keys
+			}
+			size := len(string(r[0]))
+			keys = append(keys, string(input[:size]))
+			input = input[size:]
+		}
+	}
+	return keys
+}
+
+// runPicker shows the picker in the terminal until a playlist selection is exported or printed, or the
+// picker is quit. It returns the PICK_ constant and the include parameters of the selection.
+func runPicker(library *Library, preselected []Playlist) (int, []string, error) {
+	stdin := int(os.Stdin.Fd())
+	if !term.IsTerminal(stdin) {
+		return PICK_QUIT, nil, errors.New("-interactive requires a terminal")
+	}
+	state, err := term.MakeRaw(stdin)
+	if err != nil {
+		return PICK_QUIT, nil, errors.New("-interactive requires a terminal: " + err.Error())
+	}
+	defer term.Restore(stdin, state)
+
+	p := newPicker(library, preselected)
+	buf := make([]byte, 64)
+	result := PICK_NONE
+	for result == PICK_NONE {
+		p.render(os.Stdout, terminalHeight(os.Stdout))
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return PICK_QUIT, nil, err
+		}
+		for _, key := range parseKeys(buf[:n]) {
+			if result = p.handleKey(key); result != PICK_NONE {
+				break
+			}
+		}
+	}
+	io.WriteString(os.Stdout, "\x1b[H\x1b[2J")
+	return result, p.selectors(), nil
+}
+
+// terminalHeight returns the number of lines of the terminal, or 24 if it is unknown.
+func terminalHeight(file *os.File) int {
+	_, height, err := term.GetSize(int(file.Fd()))
+	if err != nil || height <= 0 {
+		return 24
+	}
+	return height
+}
+
+// pickerCommandLine returns the command line exporting the picked playlists: the program, the original
+// flags except those selecting playlists, and an include parameter per selector. -ignoreCase is dropped,
+// as the selectors name the picked playlists exactly.
+func pickerCommandLine(program string, args []string, selectors []string) string {
+	skip := map[string]bool{"interactive": false, "includeAll": false, "includeAllWithBuiltin": false, "includePlaylistWithRegex": true, "ignoreCase": false}
+	words := []string{program}
+	for i := 0; i < len(args); i++ {
+		name := strings.TrimLeft(args[i], "-")
+		name, _, hasValue := strings.Cut(name, "=")
+		if takesValue, ok := skip[name]; ok && strings.HasPrefix(args[i], "-") {
+			if takesValue && !hasValue {
+				i++
+			}
+			continue
+		}
+		words = append(words, shellQuote(args[i]))
+	}
+	if len(selectors) > 0 {
+		words = append(words, "include")
+	}
+	for _, selector := range selectors {
+		words = append(words, shellQuote(selector))
+	}
+	return strings.Join(words, " ")
+}
+
+// shellQuote quotes a word for a POSIX shell, if needed.
+func shellQuote(word string) string {
+	if word != "" && strings.Trim(word, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-+=.,/:@%") == "" {
+		return word
+	}
+	return "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func pickerTestLibrary() *Library {
+	library := &Library{
+		Playlists: []Playlist{
+			{Name: "Library", PlaylistPersistentId: "L1", Master: true, PlaylistItems: []PlaylistItem{{1}, {2}, {3}}},
+			{Name: "Workouts", PlaylistPersistentId: "F1", Folder: true},
+			{Name: "Run", PlaylistPersistentId: "P1", ParentPersistentId: "F1", PlaylistItems: []PlaylistItem{{1}, {2}}},
+			{Name: "Walk", PlaylistPersistentId: "P2", ParentPersistentId: "F1", PlaylistItems: []PlaylistItem{{2}, {3}}},
+			{Name: "Best of *", PlaylistPersistentId: "P3", PlaylistItems: []PlaylistItem{{3}}},
+			{Name: "Run", PlaylistPersistentId: "P4"},
+		},
+	}
+	library.PlaylistMap = make(map[string]Playlist)
+	library.PlaylistIdMap = make(map[string]Playlist)
+	for _, playlist := range library.Playlists {
+		library.PlaylistMap[playlist.Name] = playlist
+		library.PlaylistIdMap[playlist.PlaylistPersistentId] = playlist
+	}
+	return library
+}
+
+func pickerRows(p *picker) string {
+	var rows []string
+	for _, node := range p.visible() {
+		rows = append(rows, node.playlist.Name)
+	}
+	return strings.Join(rows, "|")
+}
+
+func pressKeys(p *picker, keys ...string) int {
+	result := PICK_NONE
+	for _, key := range keys {
+		result = p.handleKey(key)
+	}
+	return result
+}
+
+func TestPickerTree(t *testing.T) {
+	p := newPicker(pickerTestLibrary(), nil)
+
+	if rows := pickerRows(p); rows != "Workouts|Best of *|Run" {
+		t.Fatalf("unexpected rows %v", rows)
+	}
+	if p.nodes[0].tracks != 3 {
+		t.Errorf("expected the folder to count its 3 distinct tracks, got %v", p.nodes[0].tracks)
+	}
+
+	pressKeys(p, "right")
+	if rows := pickerRows(p); rows != "Workouts|Run|Walk|Best of *|Run" {
+		t.Fatalf("unexpected rows after opening the folder %v", rows)
+	}
+	pressKeys(p, "down", "down", "left")
+	if p.cursor != 0 {
+		t.Errorf("expected left to move to the folder, got row %v", p.cursor)
+	}
+	pressKeys(p, "left")
+	if rows := pickerRows(p); rows != "Workouts|Best of *|Run" {
+		t.Errorf("unexpected rows after closing the folder %v", rows)
+	}
+}
+
+func TestPickerSelection(t *testing.T) {
+	p := newPicker(pickerTestLibrary(), nil)
+
+	pressKeys(p, "right", "down", " ", "up", " ")
+	if selectors := strings.Join(p.selectors(), "|"); selectors != "folder:Workouts" {
+		t.Errorf("expected selecting the folder to replace its playlist, got %v", selectors)
+	}
+	pressKeys(p, "down", " ")
+	if selectors := strings.Join(p.selectors(), "|"); selectors != "folder:Workouts" {
+		t.Errorf("expected playlists in a selected folder to stay selected through it, got %v", selectors)
+	}
+
+	pressKeys(p, "up", " ", "down", "down", "down", " ", "down", " ")
+	if selectors := strings.Join(p.selectors(), "|"); selectors != "name:Best of *|id:P4" {
+		t.Errorf("unexpected selectors %v", selectors)
+	}
+	if result := pressKeys(p, "enter"); result != PICK_EXPORT {
+		t.Errorf("expected enter to export, got %v", result)
+	}
+	if result := pressKeys(p, "p"); result != PICK_PRINT {
+		t.Errorf("expected p to print, got %v", result)
+	}
+	if result := pressKeys(p, "q"); result != PICK_QUIT {
+		t.Errorf("expected q to quit, got %v", result)
+	}
+}
+
+func TestPickerSearch(t *testing.T) {
+	p := newPicker(pickerTestLibrary(), nil)
+
+	if result := pressKeys(p, "/", "w", "A", "q", "backspace", "enter"); result != PICK_NONE {
+		t.Fatalf("expected typing a query not to finish the picker, got %v", result)
+	}
+	if rows := pickerRows(p); rows != "Walk" {
+		t.Errorf("unexpected search results %v", rows)
+	}
+	pressKeys(p, " ")
+	if selectors := strings.Join(p.selectors(), "|"); selectors != "Walk" {
+		t.Errorf("unexpected selectors %v", selectors)
+	}
+
+	b := &strings.Builder{}
+	p.render(b, 10)
+	if !strings.Contains(b.String(), "Workouts/Walk (2 tracks)") || !strings.Contains(b.String(), "Search: wA") {
+		t.Errorf("unexpected rendering %q", b.String())
+	}
+
+	if result := pressKeys(p, "esc"); result != PICK_NONE || p.query != "" {
+		t.Errorf("expected esc to clear the search first")
+	}
+	if result := pressKeys(p, "esc"); result != PICK_QUIT {
+		t.Errorf("expected esc to quit without a search, got %v", result)
+	}
+}
+
+func TestPickerPreselection(t *testing.T) {
+	resetGlobalVars()
+	library := pickerTestLibrary()
+	includePlaylistNames = []string{"folder:Workouts", "id:P4"}
+
+	p := newPicker(library, parsePlaylists(library))
+	if selectors := strings.Join(p.selectors(), "|"); selectors != "folder:Workouts|id:P4" {
+		t.Errorf("unexpected preselection %v", selectors)
+	}
+}
+
+func TestSelectPickedPlaylists(t *testing.T) {
+	resetGlobalVars()
+	library := pickerTestLibrary()
+	library.Playlists = append(library.Playlists, Playlist{Name: "best of 2020", PlaylistPersistentId: "P5"}, Playlist{Name: "walk", PlaylistPersistentId: "P6"})
+	library.PlaylistMap["best of 2020"] = library.Playlists[6]
+	library.PlaylistMap["walk"] = library.Playlists[7]
+	includeAllPlaylists, ignoreCase = true, true
+	excludePlaylistNames = []string{"Run"}
+
+	selectPickedPlaylists([]string{"name:Best of *", "Walk"})
+
+	var names []string
+	for _, playlist := range parsePlaylists(library) {
+		names = append(names, playlist.Name)
+	}
+	if strings.Join(names, "|") != "Best of *|Walk" {
+		t.Errorf("expected only the picked playlists, got %v", names)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	keys := parseKeys([]byte("\x1b[A\x1b[Bx \r\x7f\x1bé\x03"))
+	expected := "up|down|x| |enter|backspace|esc|é|ctrl-c"
+	if strings.Join(keys, "|") != expected {
+		t.Errorf("expected %v, got %v", expected, keys)
+	}
+}
+
+func TestPickerCommandLine(t *testing.T) {
+	args := []string{"-library", "/music/Library.xml", "-interactive", "-includeAll", "-includePlaylistWithRegex", "^B",
+		"--includePlaylistWithRegex=x", "-ignoreCase", "-output", "/out dir"}
+	line := pickerCommandLine("itunesexport", args, []string{"folder:Workouts", "Rock 'n' Roll"})
+
+	expected := `itunesexport -library /music/Library.xml -output '/out dir' include folder:Workouts 'Rock '\''n'\'' Roll'`
+	if line != expected {
+		t.Errorf("expected %v, got %v", expected, line)
+	}
+}
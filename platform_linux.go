@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 )
 
@@ -11,17 +12,156 @@ import (
 // we assume the drive was mounted to this path
 const DefaultLinuxDrive = "/mnt/itunes"
 
+// LibraryEnvVar names the library file, taking precedence over all other locations.
+const LibraryEnvVar = "ITUNES_LIBRARY"
+
+// The location of the library within a user's home folder, on macOS, Windows and Wine.
+var libraryHomePaths = []string{
+	"Music/iTunes/iTunes Music Library.xml",
+	"OneDrive/Music/iTunes/iTunes Music Library.xml",
+	"My Documents/My Music/iTunes/iTunes Music Library.xml",
+}
+
+// mountRoots are the folders drives are mounted under. Each mounted drive is searched for a library,
+// at its top level and in the home folders under Users.
+var mountRoots = []string{"/mnt", "/media/$USER", "/run/media/$USER"}
+
+// wslPathCmd converts a Windows path to the path it is mounted at in WSL.
+var wslPathCmd = func(windowsPath string) (string, error) {
+	result, err := exec.Command("wslpath", "-u", windowsPath).Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(result)), nil
+}
+
+var procVersionPath = "/proc/version"
+
 func defaultLibraryPath() (string, error) {
 	return defaultLibraryPathInternal(execCmd)
 }
 
-
+// defaultLibraryPathInternal returns the library named by LibraryEnvVar, or else the first library found
+// in libraryCandidates. If there is none, the error lists every location that was tried.
 func defaultLibraryPathInternal(cmdExecFunc func(command string) (string, error)) (string, error) {
-	if (os.Getenv("WSLENV") != "") {
-		return determineWslDefaultLibraryPath(cmdExecFunc)
-	} else {
-		return DefaultLinuxDrive, nil
+	if path := os.Getenv(LibraryEnvVar); path != "" {
+		if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+			return "", fmt.Errorf("%v is set to %v, which is not a library file", LibraryEnvVar, path)
+		}
+		return path, nil
 	}
+
+	candidates := libraryCandidates(cmdExecFunc)
+	for _, candidate := range candidates {
+		matches, _ := filepath.Glob(candidate)
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil && info.Mode().IsRegular() {
+				return match, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("No iTunes library found, specify it with -library or %v. Tried:\n  %v",
+		LibraryEnvVar, strings.Join(candidates, "\n  "))
+}
+
+// libraryCandidates returns the locations to look for the library in, in order of preference.
+// They may contain glob patterns.
+func libraryCandidates(cmdExecFunc func(command string) (string, error)) []string {
+	var candidates []string
+	if path := configuredLibraryPath(); path != "" {
+		candidates = append(candidates, globEscape(path))
+	}
+
+	if isWsl() {
+		if path, err := determineWslDefaultLibraryPath(cmdExecFunc); err == nil {
+			candidates = append(candidates, globEscape(path))
+		}
+		for _, variable := range []string{"USERPROFILE", "OneDrive"} {
+			if home, err := wslWindowsPath(cmdExecFunc, variable); err == nil {
+				for _, homePath := range libraryHomePaths {
+					candidates = append(candidates, filepath.Join(globEscape(home), homePath))
+				}
+			}
+		}
+	}
+
+	candidates = append(candidates, filepath.Join(DefaultLinuxDrive, "iTunes Music Library.xml"))
+	for _, root := range mountRoots {
+		root = globEscape(os.ExpandEnv(root))
+		for _, homePath := range libraryHomePaths {
+			candidates = append(candidates, filepath.Join(root, "*", homePath), filepath.Join(root, "*", "Users", "*", homePath))
+		}
+	}
+
+	for _, prefix := range winePrefixes() {
+		for _, homePath := range libraryHomePaths {
+			candidates = append(candidates, filepath.Join(prefix, "drive_c", "users", "*", homePath))
+		}
+	}
+	return removeDuplicates(candidates)
+}
+
+// configuredLibraryPath returns the library path in itunesexport/library in the XDG config folder, if any.
+func configuredLibraryPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	data, err := os.ReadFile(filepath.Join(configDir, "itunesexport", "library"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.SplitN(string(data), "\n", 2)[0])
+}
+
+// winePrefixes returns the Wine prefix folders, as glob patterns.
+func winePrefixes() []string {
+	var prefixes []string
+	if prefix := os.Getenv("WINEPREFIX"); prefix != "" {
+		prefixes = append(prefixes, globEscape(prefix))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		home = globEscape(home)
+		prefixes = append(prefixes, filepath.Join(home, ".wine"), filepath.Join(home, ".local", "share", "wineprefixes", "*"))
+	}
+	return prefixes
+}
+
+func isWsl() bool {
+	if os.Getenv("WSLENV") != "" || os.Getenv("WSL_DISTRO_NAME") != "" {
+		return true
+	}
+	version, err := os.ReadFile(procVersionPath)
+	return err == nil && strings.Contains(strings.ToLower(string(version)), "microsoft")
+}
+
+// wslWindowsPath converts the Windows path in the environment variable to a Linux path with wslpath.
+func wslWindowsPath(execCmdFunc func(command string) (string, error), variable string) (string, error) {
+	windowsPath, err := execCmdFunc("echo %" + variable + "%")
+	if err != nil {
+		return "", err
+	}
+	if windowsPath == "" || windowsPath == "%"+variable+"%" {
+		return "", fmt.Errorf("%v is not set", variable)
+	}
+	return wslPathCmd(windowsPath)
+}
+
+func globEscape(path string) string {
+	replacer := strings.NewReplacer("*", "\\*", "?", "\\?", "[", "\\[", "\\", "\\\\")
+	return replacer.Replace(path)
+}
+
+func removeDuplicates(values []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
 }
 
 func determineWslDefaultLibraryPath(execCmdFunc func(command string) (string, error)) (string, error) {
@@ -47,7 +187,3 @@ func execCmd(command string) (string, error) {
 	}
 	return strings.TrimSpace(string(result)), nil
 }
-
-func trimTrackLocationPrefix(path string) string {
-	return strings.TrimPrefix(path, "file://localhost")
-}
@@ -3,6 +3,8 @@ package main
 import (
 	"errors"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -23,17 +25,43 @@ func TestGetDefaultLibraryInWsl(t *testing.T) {
 		}
 	}
 
-	os.Setenv("WSLENV", "FOO")
-	result, err := defaultLibraryPathInternal(fakeExecCmdFunc)
-	if (err != nil) {
-		t.Fail()
-		t.Logf("function return error")
+	isolateLibraryDiscovery(t)
+	t.Setenv("WSLENV", "FOO")
+	wslPathCmd = func(_ string) (string, error) {
+		return "", errors.New("wslpath is not available")
 	}
+	result := libraryCandidates(fakeExecCmdFunc)
 	
 	expected := "/mnt/c/Users/SomeUser/Music/iTunes/iTunes Music Library.xml"
-	if (result != expected) {
+	if (len(result) == 0 || result[0] != expected) {
 		t.Fail()
-		t.Logf("expected %v, got %v", expected, result)
+		t.Logf("expected %v first, got %v", expected, result)
+	}
+}
+
+func TestGetDefaultLibraryInWslWithOneDrive(t *testing.T) {
+	root := isolateLibraryDiscovery(t)
+	t.Setenv("WSLENV", "FOO")
+	fakeExecCmdFunc := func(command string) (string, error) {
+		if command == "echo %OneDrive%" {
+			return `C:\Users\SomeUser\OneDrive`, nil
+		}
+		return "", errors.New("not set")
+	}
+	wslPathCmd = func(windowsPath string) (string, error) {
+		if windowsPath != `C:\Users\SomeUser\OneDrive` {
+			t.Errorf("unexpected path %v", windowsPath)
+		}
+		return filepath.Join(root, "OneDrive"), nil
+	}
+	expected := createLibraryFile(t, filepath.Join(root, "OneDrive", "Music", "iTunes", "iTunes Music Library.xml"))
+
+	result, err := defaultLibraryPathInternal(fakeExecCmdFunc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != expected {
+		t.Errorf("expected %v, got %v", expected, result)
 	}
 }
 
@@ -43,17 +71,129 @@ func TestGetDefaultLibraryInLinux(t *testing.T) {
 		return "", nil
 	}
 
-	os.Unsetenv("WSLENV")
+	root := isolateLibraryDiscovery(t)
+	expected := createLibraryFile(t, filepath.Join(root, "mnt", "usb", "Music", "iTunes", "iTunes Music Library.xml"))
+	createLibraryFile(t, filepath.Join(root, "home", ".wine", "drive_c", "users", "someuser", "Music", "iTunes", "iTunes Music Library.xml"))
+
 	result, err := defaultLibraryPathInternal(stubFunc)
 	if (err != nil) {
 		t.Fail()
 		t.Logf("function return error")
 	}
 	
-	expected := "/mnt/itunes"
 	if (result != expected) {
 		t.Fail()
 		t.Logf("expected %v, got %v", expected, result)
 	}
 }
 
+func TestGetDefaultLibraryOnMountedWindowsDrive(t *testing.T) {
+	root := isolateLibraryDiscovery(t)
+	expected := createLibraryFile(t, filepath.Join(root, "media", "someuser", "Windows", "Users", "SomeUser", "Music", "iTunes", "iTunes Music Library.xml"))
+
+	result, err := defaultLibraryPathInternal(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != expected {
+		t.Errorf("expected %v, got %v", expected, result)
+	}
+}
+
+func TestGetDefaultLibraryInWinePrefix(t *testing.T) {
+	root := isolateLibraryDiscovery(t)
+	expected := createLibraryFile(t, filepath.Join(root, "home", ".wine", "drive_c", "users", "someuser", "My Documents", "My Music", "iTunes", "iTunes Music Library.xml"))
+
+	result, err := defaultLibraryPathInternal(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != expected {
+		t.Errorf("expected %v, got %v", expected, result)
+	}
+}
+
+func TestGetDefaultLibraryFromEnvironmentAndConfig(t *testing.T) {
+	root := isolateLibraryDiscovery(t)
+	createLibraryFile(t, filepath.Join(root, "mnt", "usb", "Music", "iTunes", "iTunes Music Library.xml"))
+	configured := createLibraryFile(t, filepath.Join(root, "configured", "Library [1].xml"))
+	createLibraryFile(t, filepath.Join(root, "config", "itunesexport", "library"))
+	writeFile(t, filepath.Join(root, "config", "itunesexport", "library"), configured+"\n")
+
+	result, err := defaultLibraryPathInternal(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != configured {
+		t.Errorf("expected the configured %v, got %v", configured, result)
+	}
+
+	fromEnv := createLibraryFile(t, filepath.Join(root, "env", "Library.xml"))
+	t.Setenv(LibraryEnvVar, fromEnv)
+	result, err = defaultLibraryPathInternal(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != fromEnv {
+		t.Errorf("expected %v from %v, got %v", fromEnv, LibraryEnvVar, result)
+	}
+}
+
+func TestGetDefaultLibraryNotFound(t *testing.T) {
+	root := isolateLibraryDiscovery(t)
+
+	_, err := defaultLibraryPathInternal(nil)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, tried := range []string{
+		filepath.Join(root, "mnt", "*", "Music", "iTunes", "iTunes Music Library.xml"),
+		filepath.Join(root, "home", ".wine", "drive_c", "users", "*", "Music", "iTunes", "iTunes Music Library.xml"),
+	} {
+		if !strings.Contains(err.Error(), tried) {
+			t.Errorf("expected %v in the error, got %v", tried, err)
+		}
+	}
+}
+
+// A missing library named by the environment variable is an error, rather than a reason to look elsewhere.
+func TestGetDefaultLibraryEnvVarMissing(t *testing.T) {
+	root := isolateLibraryDiscovery(t)
+	createLibraryFile(t, filepath.Join(root, "mnt", "disk", "Music", "iTunes", "iTunes Music Library.xml"))
+	missing := filepath.Join(root, "missing.xml")
+	t.Setenv(LibraryEnvVar, missing)
+
+	result, err := defaultLibraryPathInternal(nil)
+	if err == nil || !strings.Contains(err.Error(), missing) {
+		t.Errorf("expected an error naming %v, got %v, %v", missing, result, err)
+	}
+}
+
+// isolateLibraryDiscovery points every location the library is searched in below a temporary folder,
+// which it returns, and turns WSL detection off.
+func isolateLibraryDiscovery(t *testing.T) string {
+	root := t.TempDir()
+	t.Setenv("WSLENV", "")
+	t.Setenv("WSL_DISTRO_NAME", "")
+	t.Setenv(LibraryEnvVar, "")
+	t.Setenv("WINEPREFIX", "")
+	t.Setenv("USER", "someuser")
+	t.Setenv("HOME", filepath.Join(root, "home"))
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(root, "config"))
+
+	oldMountRoots, oldProcVersionPath, oldWslPathCmd := mountRoots, procVersionPath, wslPathCmd
+	mountRoots = []string{filepath.Join(root, "mnt"), filepath.Join(root, "media", "$USER")}
+	procVersionPath = filepath.Join(root, "version")
+	t.Cleanup(func() {
+		mountRoots, procVersionPath, wslPathCmd = oldMountRoots, oldProcVersionPath, oldWslPathCmd
+	})
+	return root
+}
+
+func createLibraryFile(t *testing.T, path string) string {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, path, "<plist/>")
+	return path
+}
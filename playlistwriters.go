@@ -3,9 +3,16 @@ package main
 import (
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
+// Cover art file names, in order of preference, looked for next to a track.
+var coverArtFileNames = []string{"cover.jpg", "folder.jpg"}
+
 func m3uPlaylistWriters() (header playlistWriter, entry trackWriter, footer playlistWriter) {
 
 	const headerString = "# M3U Playlist '%v' exported %v by iTunes Export v. %v (http://www.ericdaugherty.com/dev/itunesexport/)\n"
@@ -16,7 +23,7 @@ func m3uPlaylistWriters() (header playlistWriter, entry trackWriter, footer play
 		return err
 	}
 
-	entry = func(w io.Writer, _ *ExportSettings, _ *Playlist, _ *Track, fileLocation string) error {
+	entry = func(w io.Writer, _ *ExportSettings, _ *Playlist, _ *Track, fileLocation string, _ string) error {
 		_, err := w.Write([]byte(fmt.Sprintf(entryString, fileLocation)))
 		return err
 	}
@@ -31,14 +38,25 @@ func m3uPlaylistWriters() (header playlistWriter, entry trackWriter, footer play
 func extPlaylistWriters() (header playlistWriter, entry trackWriter, footer playlistWriter) {
 
 	const headerString = "#EXTM3U\n"
+	const playlistString = "#PLAYLIST:%v\n"
 	const entryString = "#EXTINF:%v,%v - %v\n%v\n"
 
-	header = func(w io.Writer, _ *ExportSettings, _ *Playlist) error {
+	header = func(w io.Writer, exportSettings *ExportSettings, playlist *Playlist) error {
 		_, err := w.Write([]byte(fmt.Sprint(headerString)))
+		if err != nil || !exportSettings.ExtDirectives {
+			return err
+		}
+		_, err = w.Write([]byte(fmt.Sprintf(playlistString, playlist.Name)))
 		return err
 	}
 
-	entry = func(w io.Writer, _ *ExportSettings, _ *Playlist, track *Track, fileLocation string) error {
+	entry = func(w io.Writer, exportSettings *ExportSettings, _ *Playlist, track *Track, fileLocation string, coverArt string) error {
+		if exportSettings.ExtDirectives {
+			err := writeExtDirectives(w, track, coverArt)
+			if err != nil {
+				return err
+			}
+		}
 		_, err := w.Write([]byte(fmt.Sprintf(entryString, track.TotalTime/1000, track.Artist, track.Name, fileLocation)))
 		return err
 	}
@@ -73,7 +91,7 @@ func wplPlaylistWriters() (header playlistWriter, entry trackWriter, footer play
 		return err
 	}
 
-	entry = func(w io.Writer, _ *ExportSettings, _ *Playlist, _ *Track, fileLocation string) error {
+	entry = func(w io.Writer, _ *ExportSettings, _ *Playlist, _ *Track, fileLocation string, _ string) error {
 		_, err := w.Write([]byte(fmt.Sprintf(entryString, fileLocation)))
 		return err
 	}
@@ -110,7 +128,7 @@ func zplPlaylistWriters() (header playlistWriter, entry trackWriter, footer play
 		return err
 	}
 
-	entry = func(w io.Writer, _ *ExportSettings, _ *Playlist, _ *Track, fileLocation string) error {
+	entry = func(w io.Writer, _ *ExportSettings, _ *Playlist, _ *Track, fileLocation string, _ string) error {
 		_, err := w.Write([]byte(fmt.Sprintf(entryString, fileLocation)))
 		return err
 	}
@@ -122,3 +140,71 @@ func zplPlaylistWriters() (header playlistWriter, entry trackWriter, footer play
 
 	return
 }
+
+// writeExtDirectives writes the optional extended M3U directives for a track.
+// Empty values are omitted, so #EXTIMG is only written when coverArt, the formatted location of the cover art, is set.
+func writeExtDirectives(w io.Writer, track *Track, coverArt string) error {
+	artist := track.AlbumArtist
+	if artist == "" {
+		artist = track.Artist
+	}
+
+	directives := []struct {
+		name  string
+		value string
+	}{
+		{"EXTALB", track.Album},
+		{"EXTART", artist},
+		{"EXTGENRE", track.Genre},
+		{"EXTIMG", coverArt},
+	}
+
+	for _, directive := range directives {
+		if directive.value == "" {
+			continue
+		}
+		_, err := w.Write([]byte(fmt.Sprintf("#%v:%v\n", directive.name, directive.value)))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// coverArtLocation returns the path of the cover art stored in the same folder as the local file path,
+// or an empty string if there is none.
+func coverArtLocation(path string) string {
+	dir := path[:strings.LastIndexAny(path, "/"+string(filepath.Separator))+1]
+	for _, name := range coverArtFileNames {
+		if info, err := os.Stat(dir + name); err == nil && info.Mode().IsRegular() {
+			return dir + name
+		}
+	}
+	return ""
+}
+
+// hasNonASCII reports whether any of the playlist's name, its track names or their locations
+// contain non-ASCII characters, in which case the playlist should be written as .m3u8.
+func hasNonASCII(playlist *Playlist, library *Library) bool {
+	if !isASCII(playlist.Name) {
+		return true
+	}
+	for _, track := range playlist.Tracks(library) {
+		location, _ := locationPath(track.Location)
+		for _, value := range []string{track.Name, track.Artist, track.AlbumArtist, track.Album, track.Genre, location} {
+			if !isASCII(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
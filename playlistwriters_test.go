@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExtWriterWithDirectives(t *testing.T) {
+	dir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(dir, "cover.jpg"), FileContent)
+
+	exportSettings := &ExportSettings{ExtDirectives: true, PathSeparator: string(filepath.Separator)}
+	playlist := &Playlist{Name: "Road Trip"}
+	track := &Track{Name: "Song", Artist: "Artist", Album: "Album", Genre: "Rock", TotalTime: 61000}
+	fileLocation := filepath.Join(dir, "song.mp3")
+
+	header, entry, _ := extPlaylistWriters()
+	var buf bytes.Buffer
+	if err := header(&buf, exportSettings, playlist); err != nil {
+		t.Fatal(err)
+	}
+	if err := entry(&buf, exportSettings, playlist, track, fileLocation, filepath.Join(dir, "cover.jpg")); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "#EXTM3U\n#PLAYLIST:Road Trip\n" +
+		"#EXTALB:Album\n#EXTART:Artist\n#EXTGENRE:Rock\n" +
+		"#EXTIMG:" + filepath.Join(dir, "cover.jpg") + "\n" +
+		"#EXTINF:61,Artist - Song\n" + fileLocation + "\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected output.\nExpected:\n%v\nGot:\n%v", expected, buf.String())
+	}
+}
+
+func TestExtWriterWithoutDirectives(t *testing.T) {
+	exportSettings := &ExportSettings{PathSeparator: "/"}
+	playlist := &Playlist{Name: "Road Trip"}
+	track := &Track{Name: "Song", Artist: "Artist", Album: "Album", TotalTime: 61000}
+
+	header, entry, _ := extPlaylistWriters()
+	var buf bytes.Buffer
+	header(&buf, exportSettings, playlist)
+	entry(&buf, exportSettings, playlist, track, "/music/song.mp3", "")
+
+	expected := "#EXTM3U\n#EXTINF:61,Artist - Song\n/music/song.mp3\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected output.\nExpected:\n%v\nGot:\n%v", expected, buf.String())
+	}
+}
+
+// The cover art is found next to the local file and then formatted like the track location.
+func TestExtDirectivesCoverArtWithRewrittenLocation(t *testing.T) {
+	musicDir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(musicDir)
+	outputDir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(outputDir)
+	writeFile(t, filepath.Join(musicDir, "song.mp3"), FileContent)
+	writeFile(t, filepath.Join(musicDir, "folder.jpg"), FileContent)
+
+	library := &Library{
+		Tracks: map[string]Track{"1": {TrackId: 1, Name: "Song", Artist: "Artist", Location: "file://" + filepath.ToSlash(musicDir) + "/song.mp3"}},
+	}
+	exportSettings := &ExportSettings{
+		Library:           library,
+		Playlists:         []Playlist{{Name: "Mix", PlaylistItems: []PlaylistItem{{TrackId: 1}}}},
+		ExportType:        EXT,
+		ExtDirectives:     true,
+		Extension:         "m3u",
+		OutputPath:        outputDir,
+		OriginalMusicPath: filepath.ToSlash(musicDir),
+		NewMusicPath:      "/sdcard/Music",
+		PathSeparator:     "\\",
+	}
+	if err := ExportPlaylists(context.Background(), exportSettings, library); err != nil {
+		t.Fatal(err)
+	}
+
+	playlist := readFile(t, filepath.Join(outputDir, "Mix.m3u"))
+	if !strings.Contains(playlist, "#EXTIMG:\\sdcard\\Music\\folder.jpg\n") || !strings.Contains(playlist, "\\sdcard\\Music\\song.mp3\n") {
+		t.Errorf("expected the rewritten cover art location in\n%v", playlist)
+	}
+}
+
+func TestHasNonASCII(t *testing.T) {
+	library := &Library{
+		Tracks: map[string]Track{
+			"1": {Name: "Song"},
+			"2": {Name: "Canción", Location: "file:///music/Canci%C3%B3n.mp3"},
+		},
+	}
+
+	if hasNonASCII(&Playlist{Name: "Plain", PlaylistItems: []PlaylistItem{{TrackId: 1}}}, library) {
+		t.Error("expected ASCII only playlist")
+	}
+	if !hasNonASCII(&Playlist{Name: "Plain", PlaylistItems: []PlaylistItem{{TrackId: 2}}}, library) {
+		t.Error("expected non-ASCII track name to be detected")
+	}
+	if !hasNonASCII(&Playlist{Name: "Música"}, library) {
+		t.Error("expected non-ASCII playlist name to be detected")
+	}
+}
+
+func TestCsvWriter(t *testing.T) {
+	columns, err := parseColumns("name, artist,rating,location")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exportSettings := &ExportSettings{Columns: columns}
+	playlist := &Playlist{Name: "Licensing"}
+	track := &Track{Name: "Song, Part 1", Artist: "Artist", Rating: 80}
+
+	header, entry, _ := csvPlaylistWriters(',')
+	var buf bytes.Buffer
+	header(&buf, exportSettings, playlist)
+	entry(&buf, exportSettings, playlist, track, "/music/song.mp3", "")
+
+	expected := "name,artist,rating,location\n\"Song, Part 1\",Artist,4,/music/song.mp3\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected output.\nExpected:\n%v\nGot:\n%v", expected, buf.String())
+	}
+
+	if _, err := parseColumns("name,unknown"); err == nil {
+		t.Error("expected an error for an unknown column")
+	}
+}
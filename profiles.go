@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Profile bundles the settings a particular player or media server expects.
+// Any setting left empty in a profile keeps the command line value or its default.
+type Profile struct {
+	Name          string `json:"name"`
+	Description   string `json:"description,omitempty"`
+	Type          string `json:"type,omitempty"`
+	ExtDirectives bool   `json:"extDirectives,omitempty"`
+	PathStyle     string `json:"pathStyle,omitempty"`
+	PathSeparator string `json:"pathSeparator,omitempty"`
+	Encoding      string `json:"encoding,omitempty"`
+	MusicPath     string `json:"musicPath,omitempty"`
+	MusicPathOrig string `json:"musicPathOrig,omitempty"`
+}
+
+// The built in profiles, in the same format as a user profiles file.
+const builtinProfiles = `[
+  {
+    "name": "rockbox",
+    "description": "Rockbox: relative paths using / in UTF-8 .m3u8 files.",
+    "type": "M3U",
+    "pathStyle": "relative",
+    "pathSeparator": "/",
+    "encoding": "UTF-8"
+  },
+  {
+    "name": "navidrome",
+    "description": "Navidrome: extended M3U with a #PLAYLIST name.",
+    "type": "EXT",
+    "extDirectives": true,
+    "pathStyle": "absolute",
+    "pathSeparator": "/",
+    "encoding": "UTF-8"
+  },
+  {
+    "name": "plex",
+    "description": "Plex: absolute paths as the server sees them. Combine with -musicPath.",
+    "type": "M3U",
+    "pathStyle": "absolute",
+    "pathSeparator": "/",
+    "encoding": "UTF-8"
+  }
+]`
+
+// userProfilesPath returns the location of the profiles file in the user's configuration directory.
+func userProfilesPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, "itunesexport", "profiles.json")
+}
+
+// loadProfiles returns the built in profiles together with those defined in the JSON file at path,
+// keyed by lower case name. User profiles replace built in profiles with the same name.
+// A missing file is only an error if the path was given explicitly.
+func loadProfiles(path string, explicit bool) (map[string]Profile, error) {
+	profiles := make(map[string]Profile)
+	err := addProfiles(profiles, []byte(builtinProfiles))
+	if err != nil {
+		return nil, err
+	}
+
+	if path == "" {
+		return profiles, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && !explicit {
+			return profiles, nil
+		}
+		return nil, err
+	}
+	err = addProfiles(profiles, data)
+	if err != nil {
+		return nil, errors.New("Unable to parse profiles file " + path + ": " + err.Error())
+	}
+	return profiles, nil
+}
+
+func addProfiles(profiles map[string]Profile, data []byte) error {
+	var list []Profile
+	err := json.Unmarshal(data, &list)
+	if err != nil {
+		return err
+	}
+	for _, profile := range list {
+		if profile.Name == "" {
+			return errors.New("profile without a name")
+		}
+		profiles[strings.ToLower(profile.Name)] = profile
+	}
+	return nil
+}
+
+// profileNames returns the sorted names of the available profiles.
+func profileNames(profiles map[string]Profile) []string {
+	var names []string
+	for _, profile := range profiles {
+		names = append(names, profile.Name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadProfilesWithUserProfiles(t *testing.T) {
+	dir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(dir)
+
+	profilesFile := filepath.Join(dir, "profiles.json")
+	writeFile(t, profilesFile, `[
+		{"name": "Plex", "type": "EXT", "musicPath": "/data/music"},
+		{"name": "car", "type": "M3U", "pathStyle": "relative"}
+	]`)
+
+	profiles, err := loadProfiles(profilesFile, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if profiles["plex"].MusicPath != "/data/music" {
+		t.Error("expected user profile to replace the built in profile")
+	}
+	if profiles["car"].PathStyle != "relative" {
+		t.Error("expected user profile to be added")
+	}
+	if profiles["rockbox"].Encoding != "UTF-8" {
+		t.Error("expected built in profiles to remain available")
+	}
+}
+
+func TestLoadProfilesWithMissingFile(t *testing.T) {
+	if _, err := loadProfiles("/does/not/exist.json", false); err != nil {
+		t.Errorf("expected a missing default profiles file to be ignored: %v", err)
+	}
+	if _, err := loadProfiles("/does/not/exist.json", true); err == nil {
+		t.Error("expected an error for a missing explicit profiles file")
+	}
+}
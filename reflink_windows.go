@@ -0,0 +1,11 @@
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// reflink is not supported on this platform, so reflinks fall back to copying.
+func reflink(dest *os.File, src *os.File) error {
+	return errors.ErrUnsupported
+}
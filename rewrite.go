@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// RewriteRegexPrefix marks a rewrite rule as a regular expression rather than a path prefix.
+const RewriteRegexPrefix = "re:"
+
+// rewriteRule replaces the start of a music file path. A prefix rule matches whole path elements, so
+// /Volumes/Music does not match /Volumes/MusicArchive. A regex rule is anchored at the start of the path
+// and its replacement may refer to capture groups, e.g. $1.
+type rewriteRule struct {
+	text        string
+	from        string
+	pattern     *regexp.Regexp
+	patternFold *regexp.Regexp
+	to          string
+}
+
+// rewriteRules is the ordered list of -rewrite flags. The first rule that matches a path is applied.
+type rewriteRules []rewriteRule
+
+func (rules *rewriteRules) String() string {
+	if rules == nil {
+		return ""
+	}
+	var texts []string
+	for _, rule := range *rules {
+		texts = append(texts, rule.text)
+	}
+	return strings.Join(texts, ", ")
+}
+
+func (rules *rewriteRules) Set(text string) error {
+	rule, err := parseRewriteRule(text)
+	if err != nil {
+		return err
+	}
+	*rules = append(*rules, rule)
+	return nil
+}
+
+// parseRewriteRule parses "<from>=<to>" or "re:<pattern>=<replacement>". Percent-encoded prefixes,
+// as found in the library file, are decoded.
+func parseRewriteRule(text string) (rewriteRule, error) {
+	from, to, ok := strings.Cut(text, "=")
+	if !ok || from == "" {
+		return rewriteRule{}, fmt.Errorf("invalid rewrite rule %q, expected <from>=<to>", text)
+	}
+
+	if strings.HasPrefix(from, RewriteRegexPrefix) {
+		expr := strings.TrimPrefix(strings.TrimPrefix(from, RewriteRegexPrefix), "^")
+		pattern, err := regexp.Compile("^(?:" + expr + ")")
+		if err != nil {
+			return rewriteRule{}, fmt.Errorf("invalid rewrite rule %q: %v", text, err)
+		}
+		return rewriteRule{text: text, pattern: pattern, patternFold: regexp.MustCompile("(?i)" + pattern.String()), to: to}, nil
+	}
+	return newPrefixRule(text, from, to), nil
+}
+
+// newPrefixRule returns a rule replacing the prefix from with to, e.g. for -musicPath.
+func newPrefixRule(text string, from string, to string) rewriteRule {
+	if decoded, err := url.PathUnescape(from); err == nil {
+		from = decoded
+	}
+	return rewriteRule{text: text, from: trimTrailingSlash(from), to: trimTrailingSlash(to)}
+}
+
+func trimTrailingSlash(path string) string {
+	if len(path) > 1 {
+		return strings.TrimRight(path, "/\\")
+	}
+	return path
+}
+
+// apply rewrites path if the rule matches it. Windows paths are matched case-insensitively.
+func (rule rewriteRule) apply(path string) (string, bool) {
+	fold := isWindowsPath(path)
+	if rule.pattern != nil {
+		pattern := rule.pattern
+		if fold {
+			pattern = rule.patternFold
+		}
+		match := pattern.FindStringSubmatchIndex(path)
+		if match == nil {
+			return path, false
+		}
+		rewritten := pattern.ExpandString(nil, rule.to, path, match)
+		return string(rewritten) + path[match[1]:], true
+	}
+
+	if len(path) < len(rule.from) {
+		return path, false
+	}
+	prefix, rest := path[:len(rule.from)], path[len(rule.from):]
+	if prefix != rule.from && !(fold && strings.EqualFold(prefix, rule.from)) {
+		return path, false
+	}
+	if strings.HasSuffix(rule.from, "/") {
+		// Only the root folder keeps its trailing slash, which then also separates the rest.
+		rest = "/" + rest
+	} else if rest != "" && rest[0] != '/' && rest[0] != '\\' {
+		return path, false
+	}
+	return strings.TrimSuffix(rule.to, "/") + rest, true
+}
+
+// rewrite applies the first matching rule to path. It returns the index of the rule, or -1 if none matched.
+func (rules rewriteRules) rewrite(path string) (string, int) {
+	for i, rule := range rules {
+		if rewritten, ok := rule.apply(path); ok {
+			return rewritten, i
+		}
+	}
+	return path, -1
+}
+
+// isWindowsPath reports whether path is a Windows drive letter or UNC path, which are case-insensitive.
+func isWindowsPath(path string) bool {
+	return pathOrigin(path) == OS_WINDOWS
+}
+
+// musicPathRules returns the -rewrite rules followed by the rule for -musicPath, if any.
+func (exportSettings *ExportSettings) musicPathRules() rewriteRules {
+	rules := exportSettings.RewriteRules
+	if exportSettings.NewMusicPath != "" {
+		rule := newPrefixRule("-musicPath", exportSettings.OriginalMusicPath, exportSettings.NewMusicPath)
+		rules = append(rules[:len(rules):len(rules)], rule)
+	}
+	return rules
+}
+
+// explainTrackPath describes how the location of the track with trackId is turned into the path of its file.
+func explainTrackPath(w io.Writer, exportSettings *ExportSettings, library *Library, trackId string) error {
+	track, ok := library.Tracks[trackId]
+	if !ok {
+		return fmt.Errorf("no track with id %v", trackId)
+	}
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "Track %v: %v\n", trackId, track.Name)
+	fmt.Fprintf(b, "  Location: %v\n", track.Location)
+	path, err := locationPath(track.Location)
+	if err != nil {
+		return fmt.Errorf("unable to parse the location: %v", err)
+	}
+	fmt.Fprintf(b, "  Path:     %v\n", path)
+	if isWindowsPath(path) {
+		fmt.Fprintf(b, "  Windows path, rules match case-insensitively.\n")
+	}
+
+	rules := exportSettings.musicPathRules()
+	rewritten, applied := rules.rewrite(path)
+	for i, rule := range rules {
+		result := "no match"
+		if i == applied {
+			result = "applied"
+		} else if applied >= 0 && i > applied {
+			result = "not tried"
+		}
+		fmt.Fprintf(b, "  Rule %v:   %v (%v)\n", i+1, rule.text, result)
+	}
+	if applied < 0 {
+		fmt.Fprintf(b, "  No rule applied.\n")
+	}
+	fmt.Fprintf(b, "  Result:   %v\n", rewritten)
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
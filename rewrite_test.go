@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRewriteRules(t *testing.T) {
+	var rules rewriteRules
+	for _, text := range []string{
+		"/Volumes/Music=/mnt/music",
+		"/Volumes/My%20Archive/=/mnt/archive/",
+		"re:D:/iTunes/(Music|Podcasts)=/mnt/itunes/${1}-files",
+		"/=/mnt/root",
+	} {
+		if err := rules.Set(text); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+		rule     int
+	}{
+		{"/Volumes/Music/Artist/song.mp3", "/mnt/music/Artist/song.mp3", 0},
+		{"/Volumes/MusicOld/song.mp3", "/mnt/root/Volumes/MusicOld/song.mp3", 3},
+		{"/Volumes/My Archive/song.mp3", "/mnt/archive/song.mp3", 1},
+		{"d:/itunes/music/song.mp3", "/mnt/itunes/music-files/song.mp3", 2},
+		{"/D:/iTunes/Podcasts/show.mp3", "/mnt/root/D:/iTunes/Podcasts/show.mp3", 3},
+		{"relative/song.mp3", "relative/song.mp3", -1},
+	}
+	for _, test := range tests {
+		rewritten, rule := rules.rewrite(test.path)
+		if rewritten != test.expected || rule != test.rule {
+			t.Errorf("%v: expected %v by rule %v, got %v by rule %v", test.path, test.expected, test.rule, rewritten, rule)
+		}
+	}
+}
+
+func TestRewriteRulesCaseInsensitiveForWindowsPaths(t *testing.T) {
+	rule := newPrefixRule("", "C:/Users/Me/Music", "/mnt/music")
+	if rewritten, ok := rule.apply("c:/users/me/music/song.mp3"); !ok || rewritten != "/mnt/music/song.mp3" {
+		t.Errorf("expected the Windows path to match case-insensitively, got %v", rewritten)
+	}
+	rule = newPrefixRule("", "/Users/Me/Music", "/mnt/music")
+	if _, ok := rule.apply("/users/me/music/song.mp3"); ok {
+		t.Error("expected other paths to match case-sensitively")
+	}
+}
+
+func TestParseRewriteRuleErrors(t *testing.T) {
+	for _, text := range []string{"/no/separator", "=/mnt", "re:([a-z=/mnt"} {
+		if _, err := parseRewriteRule(text); err == nil {
+			t.Errorf("%v: expected an error", text)
+		}
+	}
+}
+
+func TestExplainTrackPath(t *testing.T) {
+	library := &Library{Tracks: map[string]Track{
+		"42": {TrackId: 42, Name: "Song", Location: "file://localhost/Volumes/Music/My%20Song.mp3"},
+	}}
+	exportSettings := &ExportSettings{OriginalMusicPath: "/Volumes/Music", NewMusicPath: "/mnt/music"}
+	exportSettings.RewriteRules.Set("/Volumes/Archive=/mnt/archive")
+
+	b := &strings.Builder{}
+	if err := explainTrackPath(b, exportSettings, library, "42"); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"Rule 1:   /Volumes/Archive=/mnt/archive (no match)",
+		"Rule 2:   -musicPath (applied)",
+		"Result:   /mnt/music/My Song.mp3",
+	} {
+		if !strings.Contains(b.String(), expected) {
+			t.Errorf("expected %q in\n%v", expected, b.String())
+		}
+	}
+}
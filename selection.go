@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The prefixes of include and exclude parameters selecting playlists by something other than their name.
+// FolderSelectorPrefix selects a folder by its path.
+const (
+	NameSelectorPrefix  = "name:"
+	GlobSelectorPrefix  = "glob:"
+	RegexSelectorPrefix = "re:"
+	IdSelectorPrefix    = "id:"
+)
+
+const (
+	SELECT_NAME = iota
+	SELECT_GLOB
+	SELECT_REGEX
+	SELECT_FOLDER
+	SELECT_ID
+)
+
+// playlistSelector is an include or exclude parameter. A selector that matches a folder also matches
+// everything inside it.
+type playlistSelector struct {
+	text       string
+	kind       int
+	value      string
+	pattern    *regexp.Regexp
+	ignoreCase bool
+}
+
+// parsePlaylistSelector parses an include or exclude parameter: a playlist name, which may be a glob
+// pattern like "Best of *", or one of name:<exact name>, glob:<pattern>, re:<regular expression>,
+// folder:<folder path> or id:<persistent id>.
+func parsePlaylistSelector(text string, ignoreCase bool) (playlistSelector, error) {
+	selector := playlistSelector{text: text, kind: SELECT_NAME, value: text, ignoreCase: ignoreCase}
+	var err error
+	switch {
+	case strings.HasPrefix(text, NameSelectorPrefix):
+		selector.value = strings.TrimPrefix(text, NameSelectorPrefix)
+		return selector, nil
+	case strings.HasPrefix(text, GlobSelectorPrefix):
+		selector.kind = SELECT_GLOB
+		selector.value = strings.TrimPrefix(text, GlobSelectorPrefix)
+		selector.pattern, err = globPattern(selector.value, ignoreCase)
+	case strings.HasPrefix(text, RegexSelectorPrefix):
+		selector.kind = SELECT_REGEX
+		selector.value = strings.TrimPrefix(text, RegexSelectorPrefix)
+		expr := selector.value
+		if ignoreCase {
+			expr = "(?i)" + expr
+		}
+		selector.pattern, err = regexp.Compile(expr)
+	case strings.HasPrefix(text, FolderSelectorPrefix):
+		selector.kind = SELECT_FOLDER
+		selector.value, _ = parseFolderSelector(text)
+		selector.value = safeFolderPath(selector.value)
+	case strings.HasPrefix(text, IdSelectorPrefix):
+		selector.kind = SELECT_ID
+		selector.value = strings.TrimPrefix(text, IdSelectorPrefix)
+	case strings.ContainsAny(text, "*?["):
+		// A name with wildcards is a glob pattern, unless a playlist has exactly that name.
+		selector.pattern, err = globPattern(text, ignoreCase)
+	}
+	if err != nil {
+		return playlistSelector{}, fmt.Errorf("invalid playlist selector %q: %v", text, err)
+	}
+	return selector, nil
+}
+
+// parsePlaylistSelectors parses the include or exclude parameters.
+func parsePlaylistSelectors(texts []string, ignoreCase bool) ([]playlistSelector, error) {
+	var selectors []playlistSelector
+	for _, text := range texts {
+		selector, err := parsePlaylistSelector(text, ignoreCase)
+		if err != nil {
+			return nil, err
+		}
+		selectors = append(selectors, selector)
+	}
+	return selectors, nil
+}
+
+// globPattern converts a glob pattern, where * matches any text, ? any character and [...] a character
+// class, into a regular expression matching whole names.
+func globPattern(glob string, ignoreCase bool) (*regexp.Regexp, error) {
+	b := &strings.Builder{}
+	if ignoreCase {
+		b.WriteString("(?i)")
+	}
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("missing ] in %q", glob)
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// matchesPlaylist reports whether the selector matches the playlist itself, ignoring its folders.
+func (s playlistSelector) matchesPlaylist(playlist Playlist, library *Library) bool {
+	switch s.kind {
+	case SELECT_NAME:
+		if s.equal(playlist.Name, s.value) {
+			return true
+		}
+		return s.pattern != nil && !s.namesPlaylist(library) && s.pattern.MatchString(playlist.Name)
+	case SELECT_GLOB, SELECT_REGEX:
+		return s.pattern.MatchString(playlist.Name)
+	case SELECT_FOLDER:
+		return playlist.Folder && s.equal(folderPath(playlist, library), s.value)
+	case SELECT_ID:
+		return strings.EqualFold(playlist.PlaylistPersistentId, s.value)
+	default:
+		return false
+	}
+}
+
+// namesPlaylist reports whether a playlist has exactly the name of the selector. An exact name wins,
+// so the name is then not also matched as a glob pattern.
+func (s playlistSelector) namesPlaylist(library *Library) bool {
+	if _, ok := library.PlaylistMap[s.value]; ok {
+		return true
+	}
+	if s.ignoreCase {
+		for _, playlist := range library.Playlists {
+			if strings.EqualFold(playlist.Name, s.value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s playlistSelector) equal(a string, b string) bool {
+	if s.ignoreCase {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// matches reports whether the selector matches the playlist or one of the folders it is in.
+func (s playlistSelector) matches(playlist Playlist, library *Library) bool {
+	for _, p := range playlistAncestors(playlist, library) {
+		if s.matchesPlaylist(p, library) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectFrom returns the playlists the selector matches, in library order.
+func (s playlistSelector) selectFrom(library *Library) []Playlist {
+	if s.kind == SELECT_NAME && !s.ignoreCase {
+		if playlist, ok := library.PlaylistMap[s.value]; ok {
+			if playlist.Folder {
+				return expandFolder(playlist, library)
+			}
+			return []Playlist{playlist}
+		}
+	}
+
+	var playlists []Playlist
+	for _, playlist := range library.Playlists {
+		if s.matches(playlist, library) {
+			playlists = append(playlists, playlist)
+		}
+	}
+	return playlists
+}
+
+// selectPlaylists adds the playlists matching any of the includes to the base playlists, in the order of
+// the includes, and then removes those matching any of the excludes. Each playlist is selected once.
+func selectPlaylists(library *Library, base []Playlist, includes []playlistSelector, excludes []playlistSelector) []Playlist {
+	playlists := base
+	for _, include := range includes {
+		selected := include.selectFrom(library)
+		if len(selected) == 0 {
+			switch include.kind {
+			case SELECT_NAME:
+				fmt.Printf("Unable to find matching playlist for name: %q. Skipping Playlist.\n", include.value)
+			case SELECT_FOLDER:
+				fmt.Printf("Unable to find matching folder for path: %q. Skipping Folder.\n", include.value)
+			default:
+				fmt.Printf("No playlist matches %q.\n", include.text)
+			}
+		}
+		playlists = append(playlists, selected...)
+	}
+
+	var filteredPlaylists []Playlist
+	included := make(map[string]bool)
+	for _, playlist := range playlists {
+		key := playlist.PlaylistPersistentId
+		if key == "" {
+			key = NameSelectorPrefix + playlist.Name
+		}
+		if included[key] || matchesAny(excludes, playlist, library) {
+			continue
+		}
+		included[key] = true
+		filteredPlaylists = append(filteredPlaylists, playlist)
+	}
+	return filteredPlaylists
+}
+
+func matchesAny(selectors []playlistSelector, playlist Playlist, library *Library) bool {
+	for _, selector := range selectors {
+		if selector.matches(playlist, library) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func selectionTestLibrary() *Library {
+	library := &Library{
+		Playlists: []Playlist{
+			{Name: "Library", PlaylistPersistentId: "L1", DistinguishedKind: 0, Master: true},
+			{Name: "Music", PlaylistPersistentId: "B1", DistinguishedKind: 4},
+			{Name: "Best of 2019", PlaylistPersistentId: "P1"},
+			{Name: "best of 2020", PlaylistPersistentId: "P2"},
+			{Name: "Best *", PlaylistPersistentId: "P3"},
+			{Name: "Archive", PlaylistPersistentId: "F1", Folder: true},
+			{Name: "Old Mix", PlaylistPersistentId: "P4", ParentPersistentId: "F1"},
+			{Name: "Chill", PlaylistPersistentId: "P5"},
+		},
+	}
+	library.PlaylistMap = make(map[string]Playlist)
+	library.PlaylistIdMap = make(map[string]Playlist)
+	for _, playlist := range library.Playlists {
+		library.PlaylistMap[playlist.Name] = playlist
+		library.PlaylistIdMap[playlist.PlaylistPersistentId] = playlist
+	}
+	return library
+}
+
+func TestSelectPlaylists(t *testing.T) {
+	library := selectionTestLibrary()
+
+	tests := []struct {
+		include    []string
+		exclude    []string
+		ignoreCase bool
+		expected   []string
+	}{
+		{[]string{"Best of *"}, nil, false, []string{"Best of 2019"}},
+		{[]string{"Best of *"}, nil, true, []string{"Best of 2019", "best of 2020"}},
+		{[]string{"Best *"}, nil, false, []string{"Best *"}},
+		{[]string{"glob:Best *"}, nil, false, []string{"Best of 2019", "Best *"}},
+		{[]string{"name:Best *"}, nil, false, []string{"Best *"}},
+		{[]string{"glob:[Bb]est of 20[!1]?"}, nil, false, []string{"best of 2020"}},
+		{[]string{"re:20(19|20)$"}, nil, false, []string{"Best of 2019", "best of 2020"}},
+		{[]string{"re:^best"}, []string{"re:2020"}, true, []string{"Best of 2019", "Best *"}},
+		{[]string{"id:P5", "Chill", "id:F1"}, nil, false, []string{"Chill", "Archive", "Old Mix"}},
+		{[]string{"re:."}, []string{"folder:archive", "id:B1", "Library", "glob:* of *"}, true, []string{"Best *", "Chill"}},
+		{[]string{"re:."}, []string{"folder:archive"}, false, []string{"Library", "Music", "Best of 2019", "best of 2020", "Best *", "Archive", "Old Mix", "Chill"}},
+		{[]string{"re:^Best"}, []string{"Best *"}, false, []string{"Best of 2019"}},
+		{[]string{"re:^Best"}, []string{"best *"}, true, []string{"Best of 2019", "best of 2020"}},
+		{[]string{"re:^Best"}, []string{"Best of*"}, false, []string{"Best *"}},
+		{[]string{"chill"}, nil, false, nil},
+		{[]string{"chill"}, nil, true, []string{"Chill"}},
+	}
+	for _, test := range tests {
+		includes, err := parsePlaylistSelectors(test.include, test.ignoreCase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		excludes, err := parsePlaylistSelectors(test.exclude, test.ignoreCase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, playlist := range selectPlaylists(library, nil, includes, excludes) {
+			names = append(names, playlist.Name)
+		}
+		if strings.Join(names, "|") != strings.Join(test.expected, "|") {
+			t.Errorf("include %v exclude %v ignoreCase %v: expected %v, got %v",
+				test.include, test.exclude, test.ignoreCase, test.expected, names)
+		}
+	}
+}
+
+func TestIncludeAllCombinedWithSelectors(t *testing.T) {
+	resetGlobalVars()
+	library := selectionTestLibrary()
+
+	includeAllPlaylists = true
+	includePlaylistWithRegex = "^Mus"
+	includePlaylistNames = []string{"Chill"}
+	excludePlaylistNames = []string{"Best of *", "folder:Archive"}
+	var names []string
+	for _, playlist := range parsePlaylists(library) {
+		names = append(names, playlist.Name)
+	}
+
+	expected := "best of 2020|Best *|Chill|Music"
+	if strings.Join(names, "|") != expected {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
+
+func TestInvalidPlaylistSelectors(t *testing.T) {
+	for _, text := range []string{"re:(", "glob:[abc", "Best [of"} {
+		if _, err := parsePlaylistSelector(text, false); err == nil {
+			t.Errorf("expected an error for %q", text)
+		}
+	}
+
+	resetGlobalVars()
+	includePlaylistWithRegex = "a("
+	if _, _, err := playlistSelectors(); err == nil {
+		t.Error("expected an error for an invalid -includePlaylistWithRegex")
+	}
+}
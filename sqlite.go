@@ -0,0 +1,204 @@
+//go:build !windows || amd64 || arm64
+
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	_ "modernc.org/sqlite"
+)
+
+// The tables are created if missing, so re-running the export updates an existing database.
+// Rows are keyed by persistent ID. Tracks and playlists removed from the library are kept.
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS tracks (
+		persistent_id TEXT PRIMARY KEY,
+		track_id INTEGER,
+		name TEXT,
+		artist TEXT,
+		album_artist TEXT,
+		composer TEXT,
+		album TEXT,
+		genre TEXT,
+		kind TEXT,
+		size INTEGER,
+		total_time_ms INTEGER,
+		track_number INTEGER,
+		disc_number INTEGER,
+		year INTEGER,
+		bit_rate INTEGER,
+		date_added TEXT,
+		date_modified TEXT,
+		play_count INTEGER,
+		play_date TEXT,
+		skip_count INTEGER,
+		skip_date TEXT,
+		rating REAL,
+		loved INTEGER,
+		disabled INTEGER,
+		comments TEXT,
+		grouping TEXT,
+		work TEXT,
+		location TEXT
+	)`,
+	`CREATE INDEX IF NOT EXISTS tracks_artist ON tracks (artist)`,
+	`CREATE INDEX IF NOT EXISTS tracks_album ON tracks (album)`,
+	`CREATE TABLE IF NOT EXISTS folders (
+		persistent_id TEXT PRIMARY KEY,
+		name TEXT,
+		parent_persistent_id TEXT,
+		path TEXT
+	)`,
+	`CREATE TABLE IF NOT EXISTS playlists (
+		persistent_id TEXT PRIMARY KEY,
+		playlist_id INTEGER,
+		name TEXT,
+		parent_persistent_id TEXT,
+		distinguished_kind INTEGER,
+		master INTEGER,
+		visible INTEGER,
+		smart INTEGER
+	)`,
+	`CREATE INDEX IF NOT EXISTS playlists_name ON playlists (name)`,
+	`CREATE TABLE IF NOT EXISTS playlist_items (
+		playlist_persistent_id TEXT,
+		position INTEGER,
+		track_persistent_id TEXT,
+		PRIMARY KEY (playlist_persistent_id, position)
+	)`,
+	`CREATE INDEX IF NOT EXISTS playlist_items_track ON playlist_items (track_persistent_id)`,
+}
+
+const sqliteUpsertTrack = `INSERT INTO tracks (persistent_id, track_id, name, artist, album_artist, composer, album, genre,
+		kind, size, total_time_ms, track_number, disc_number, year, bit_rate, date_added, date_modified, play_count,
+		play_date, skip_count, skip_date, rating, loved, disabled, comments, grouping, work, location)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (persistent_id) DO UPDATE SET track_id = excluded.track_id, name = excluded.name,
+		artist = excluded.artist, album_artist = excluded.album_artist, composer = excluded.composer,
+		album = excluded.album, genre = excluded.genre, kind = excluded.kind, size = excluded.size,
+		total_time_ms = excluded.total_time_ms, track_number = excluded.track_number,
+		disc_number = excluded.disc_number, year = excluded.year, bit_rate = excluded.bit_rate,
+		date_added = excluded.date_added, date_modified = excluded.date_modified,
+		play_count = excluded.play_count, play_date = excluded.play_date, skip_count = excluded.skip_count,
+		skip_date = excluded.skip_date, rating = excluded.rating, loved = excluded.loved,
+		disabled = excluded.disabled, comments = excluded.comments, grouping = excluded.grouping,
+		work = excluded.work, location = excluded.location`
+
+const sqliteUpsertFolder = `INSERT INTO folders (persistent_id, name, parent_persistent_id, path) VALUES (?, ?, ?, ?)
+	ON CONFLICT (persistent_id) DO UPDATE SET name = excluded.name,
+		parent_persistent_id = excluded.parent_persistent_id, path = excluded.path`
+
+const sqliteUpsertPlaylist = `INSERT INTO playlists (persistent_id, playlist_id, name, parent_persistent_id,
+		distinguished_kind, master, visible, smart)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (persistent_id) DO UPDATE SET playlist_id = excluded.playlist_id, name = excluded.name,
+		parent_persistent_id = excluded.parent_persistent_id, distinguished_kind = excluded.distinguished_kind,
+		master = excluded.master, visible = excluded.visible, smart = excluded.smart`
+
+// exportSqliteCommand writes the library into the SQLite database named by the first argument.
+func exportSqliteCommand(args []string) error {
+	var libraryPath string
+	flags := newCommandFlags("export-sqlite", &libraryPath)
+	positional, err := parseCommandArgs(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errors.New("usage: export-sqlite [-library <file path>] <database file>")
+	}
+	databasePath := positional[0]
+
+	library, err := loadCommandLibrary(libraryPath)
+	if err != nil {
+		return err
+	}
+
+	err = exportSqlite(databasePath, library)
+	if err == nil {
+		fmt.Printf("Exported %v tracks and %v playlists to %v\n", len(library.Tracks), len(library.Playlists), databasePath)
+	}
+	return err
+}
+
+// exportSqlite creates or updates the database at databasePath with the contents of the library.
+func exportSqlite(databasePath string, library *Library) error {
+	db, err := sql.Open("sqlite", databasePath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	for _, statement := range sqliteSchema {
+		if _, err = db.Exec(statement); err != nil {
+			return err
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	err = writeSqliteLibrary(tx, library)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func writeSqliteLibrary(tx *sql.Tx, library *Library) error {
+	upsertTrack, err := tx.Prepare(sqliteUpsertTrack)
+	if err != nil {
+		return err
+	}
+	defer upsertTrack.Close()
+
+	insertItem, err := tx.Prepare(`INSERT INTO playlist_items (playlist_persistent_id, position, track_persistent_id)
+		VALUES (?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insertItem.Close()
+
+	for _, t := range sortedLibraryTracks(library) {
+		_, err = upsertTrack.Exec(t.PersistentId, t.TrackId, t.Name, t.Artist, t.AlbumArtist, t.Composer,
+			t.Album, t.Genre, t.Kind, t.Size, t.TotalTime, t.TrackNumber, t.DiscNumber, t.Year, t.BitRate,
+			formatDate(t.DateAdded), formatDate(t.DateModified), t.PlayCount, formatDate(t.PlayDateUTC),
+			t.SkipCount, formatDate(t.SkipDate), float64(t.Rating)/20, t.Loved, t.Disabled, t.Comments,
+			t.Grouping, t.Work, t.Location)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, p := range library.Playlists {
+		if p.Folder {
+			_, err = tx.Exec(sqliteUpsertFolder, p.PlaylistPersistentId, p.Name, p.ParentPersistentId,
+				buildPlaylistPath(p, library))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		_, err = tx.Exec(sqliteUpsertPlaylist, p.PlaylistPersistentId, p.PlaylistId, p.Name, p.ParentPersistentId,
+			p.DistinguishedKind, p.Master, p.Visible, len(p.SmartCriteria) > 0)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`DELETE FROM playlist_items WHERE playlist_persistent_id = ?`, p.PlaylistPersistentId)
+		if err != nil {
+			return err
+		}
+		for position, track := range p.Tracks(library) {
+			_, err = insertItem.Exec(p.PlaylistPersistentId, position, track.PersistentId)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
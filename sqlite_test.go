@@ -0,0 +1,54 @@
+//go:build !windows || amd64 || arm64
+
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExportSqliteUpserts(t *testing.T) {
+	dir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(dir)
+	databasePath := filepath.Join(dir, "library.db")
+
+	library := &Library{
+		Tracks: map[string]Track{"1": {TrackId: 1, PersistentId: "AAA", Name: "Song", Artist: "Artist"}},
+		Playlists: []Playlist{
+			{Name: "Folder", PlaylistPersistentId: "F1", Folder: true},
+			{Name: "Mix", PlaylistPersistentId: "P1", ParentPersistentId: "F1", PlaylistItems: []PlaylistItem{{TrackId: 1}}},
+		},
+	}
+	library.PlaylistIdMap = map[string]Playlist{"F1": library.Playlists[0]}
+
+	if err := exportSqlite(databasePath, library); err != nil {
+		t.Fatal(err)
+	}
+	library.Tracks["1"] = Track{TrackId: 1, PersistentId: "AAA", Name: "Renamed", Artist: "Artist"}
+	if err := exportSqlite(databasePath, library); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite", databasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var tracks, items int
+	var name, folderPath string
+	db.QueryRow(`SELECT COUNT(*), MAX(name) FROM tracks`).Scan(&tracks, &name)
+	db.QueryRow(`SELECT COUNT(*) FROM playlist_items`).Scan(&items)
+	db.QueryRow(`SELECT path FROM folders WHERE persistent_id = 'F1'`).Scan(&folderPath)
+	if tracks != 1 || name != "Renamed" {
+		t.Errorf("expected the track to be updated, got %v tracks named %q", tracks, name)
+	}
+	if items != 1 {
+		t.Errorf("expected 1 playlist item, got %v", items)
+	}
+	if folderPath != "Folder" {
+		t.Errorf("unexpected folder path %q", folderPath)
+	}
+}
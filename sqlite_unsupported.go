@@ -0,0 +1,10 @@
+//go:build windows && !amd64 && !arm64
+
+package main
+
+import "errors"
+
+// exportSqliteCommand is not available where modernc.org/sqlite has no port, e.g. 32-bit Windows.
+func exportSqliteCommand(args []string) error {
+	return errors.New("export-sqlite is not supported on this platform")
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// StateFileName is the file in the output directory that records what the last export wrote.
+const StateFileName = ".itunesexport-state.json"
+
+const stateVersion = 1
+
+// PlaylistState records the playlist file written for a playlist and the playlistHash it was written with.
+type PlaylistState struct {
+	Name string `json:"name"`
+	File string `json:"file"`
+	Hash string `json:"hash"`
+}
+
+type exportState struct {
+	Version   int                      `json:"version"`
+	Playlists map[string]PlaylistState `json:"playlists"`
+}
+
+// loadExportState reads the state file from the output directory. A missing or outdated state file
+// results in an empty state, so everything is exported again.
+func loadExportState(outputPath string) (map[string]PlaylistState, error) {
+	states := make(map[string]PlaylistState)
+	data, err := os.ReadFile(filepath.Join(outputPath, StateFileName))
+	if os.IsNotExist(err) {
+		return states, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var state exportState
+	if err = json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("unable to read %v: %v", StateFileName, err)
+	}
+	if state.Version != stateVersion || state.Playlists == nil {
+		return states, nil
+	}
+	return state.Playlists, nil
+}
+
+// saveExportState writes the state file into the output directory. It is replaced atomically, so an
+// interrupted export leaves the previous state file intact.
+func saveExportState(outputPath string, states map[string]PlaylistState) error {
+	data, err := json.MarshalIndent(exportState{stateVersion, states}, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := createAtomicFile(filepath.Join(outputPath, StateFileName), 0)
+	if err != nil {
+		return err
+	}
+	defer file.Abort()
+	if _, err = file.Write(data); err != nil {
+		return err
+	}
+	return file.Commit(nil)
+}
+
+// removeStalePlaylists deletes the files of playlists in the state that were not exported by this run,
+// because they no longer exist or are no longer selected, and drops them from the state.
+func removeStalePlaylists(states map[string]PlaylistState, exported map[string]bool) {
+	for key, state := range states {
+		if exported[key] {
+			continue
+		}
+		fmt.Printf("Removing Playlist %v\n", state.Name)
+		if err := os.Remove(state.File); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("Unable to remove %v: %v\n", state.File, err)
+			continue
+		}
+		delete(states, key)
+	}
+}
+
+// playlistKey identifies a playlist in the PlaylistStates of the ExportSettings.
+func playlistKey(playlist *Playlist) string {
+	if playlist.PlaylistPersistentId != "" {
+		return playlist.PlaylistPersistentId
+	}
+	return playlist.Name
+}
+
+// playlistHash returns a hash of everything that determines the exported playlist file: the settings,
+// the file name, and the trackColumns of every track in the playlist, which include every track field
+// the playlist writers emit. If the hash is unchanged since the last export, the playlist does not have
+// to be written again.
+func playlistHash(exportSettings *ExportSettings, playlist *Playlist, fileName string) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%v\n%v\n%v\n", settingsFingerprint(exportSettings), fileName, playlist.Name)
+	for _, track := range playlist.Tracks(exportSettings.Library) {
+		io.WriteString(hash, strings.Join(columnValues(trackColumns, &track, track.Location), "\x00"))
+		io.WriteString(hash, "\n")
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// settingsFingerprint describes the export settings that affect the playlist files and the copies of their tracks.
+func settingsFingerprint(exportSettings *ExportSettings) string {
+	return fmt.Sprintf("%v|%v|%v|%v|%v|%v|%v|%v|%v|%v|%v|%v|%v|%v|%v|%v|%v|%v|%v|%v",
+		Version, exportSettings.ExportType, exportSettings.Extension, exportSettings.OutputPath,
+		exportSettings.CopyType, exportSettings.LinkMode, exportSettings.OriginalMusicPath, exportSettings.NewMusicPath,
+		exportSettings.RewriteRules.String(),
+		exportSettings.PathSeparator, exportSettings.ExtDirectives, exportSettings.Artwork, exportSettings.ArtworkSize,
+		exportSettings.TagFields, exportSettings.RelativePaths, columnNames(exportSettings.Columns),
+		exportSettings.FileMode, exportSettings.DirMode, exportSettings.ModTime, exportSettings.Xattrs)
+}
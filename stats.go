@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LibraryStats summarises a library for the stats command.
+type LibraryStats struct {
+	TotalTracks       int           `json:"totalTracks"`
+	TotalTime         int64         `json:"totalTimeMs"`
+	TotalSize         int64         `json:"totalSizeBytes"`
+	ByKind            []StatsCount  `json:"byKind"`
+	ByGenre           []StatsCount  `json:"byGenre"`
+	ByYear            []StatsCount  `json:"byYear"`
+	ByDecade          []StatsCount  `json:"byDecade"`
+	TopArtists        []StatsCount  `json:"topArtists"`
+	TopAlbums         []StatsCount  `json:"topAlbums"`
+	Ratings           []StatsCount  `json:"ratings"`
+	NeverPlayed       int           `json:"neverPlayed"`
+	MostSkipped       []StatsCount  `json:"mostSkipped"`
+	TracksPerPlaylist []StatsCount  `json:"tracksPerPlaylist"`
+	Growth            []StatsGrowth `json:"growth"`
+}
+
+// StatsCount is a named count, e.g. the number of tracks in a genre or the plays of an artist.
+type StatsCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// StatsGrowth is the number of tracks added in a month, and the library size at the end of it.
+type StatsGrowth struct {
+	Month string `json:"month"`
+	Added int    `json:"added"`
+	Total int    `json:"total"`
+}
+
+func statsCommand(args []string) error {
+	var libraryPath, format, output string
+	var top int
+	flags := newCommandFlags("stats", &libraryPath)
+	flags.StringVar(&format, "format", "text", "")
+	flags.StringVar(&output, "output", "", "")
+	flags.IntVar(&top, "top", 10, "")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	format = strings.ToLower(format)
+	if format != "text" && format != "json" && format != "csv" {
+		return errors.New("Unknown Format: " + format)
+	}
+
+	library, err := loadCommandLibrary(libraryPath)
+	if err != nil {
+		return err
+	}
+	stats := buildLibraryStats(library, top)
+
+	w, closeOutput, err := commandOutput(output)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "text":
+		err = writeStatsText(w, stats)
+	case "json":
+		err = writeStatsJSON(w, stats)
+	case "csv":
+		err = writeStatsCSV(w, stats)
+	}
+	if closeErr := closeOutput(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// buildLibraryStats collects the statistics of the library. Top lists are limited to top entries.
+func buildLibraryStats(library *Library, top int) *LibraryStats {
+	stats := &LibraryStats{}
+	kinds := make(map[string]int)
+	genres := make(map[string]int)
+	years := make(map[string]int)
+	decades := make(map[string]int)
+	artistPlays := make(map[string]int)
+	albumPlays := make(map[string]int)
+	ratings := make(map[string]int)
+	skips := make(map[string]int)
+	added := make(map[string]int)
+
+	for _, track := range library.Tracks {
+		stats.TotalTracks++
+		stats.TotalTime += int64(track.TotalTime)
+		stats.TotalSize += int64(track.Size)
+
+		kinds[valueOrUnknown(track.Kind)]++
+		genres[valueOrUnknown(track.Genre)]++
+		if track.Year > 0 {
+			years[strconv.Itoa(track.Year)]++
+			decades[fmt.Sprintf("%ds", track.Year/10*10)]++
+		} else {
+			years["Unknown"]++
+			decades["Unknown"]++
+		}
+
+		artist := track.AlbumArtist
+		if artist == "" {
+			artist = track.Artist
+		}
+		artistPlays[valueOrUnknown(artist)] += track.PlayCount
+		albumPlays[valueOrUnknown(track.Album)+" - "+valueOrUnknown(artist)] += track.PlayCount
+
+		ratings[fmt.Sprintf("%d stars", track.Rating/20)]++
+		if track.PlayCount == 0 {
+			stats.NeverPlayed++
+		}
+		if track.SkipCount > 0 {
+			skips[track.Artist+" - "+track.Name] += track.SkipCount
+		}
+		if !track.DateAdded.IsZero() {
+			added[track.DateAdded.UTC().Format("2006-01")]++
+		}
+	}
+
+	stats.ByKind = sortedCounts(kinds, 0)
+	stats.ByGenre = sortedCounts(genres, 0)
+	stats.ByYear = sortedByName(years)
+	stats.ByDecade = sortedByName(decades)
+	stats.TopArtists = sortedCounts(artistPlays, top)
+	stats.TopAlbums = sortedCounts(albumPlays, top)
+	stats.Ratings = sortedByName(ratings)
+	stats.MostSkipped = sortedCounts(skips, top)
+
+	for _, playlist := range library.Playlists {
+		if !playlist.Folder {
+			stats.TracksPerPlaylist = append(stats.TracksPerPlaylist, StatsCount{playlist.Name, len(playlist.PlaylistItems)})
+		}
+	}
+
+	total := 0
+	for _, month := range sortedByName(added) {
+		total += month.Count
+		stats.Growth = append(stats.Growth, StatsGrowth{month.Name, month.Count, total})
+	}
+	return stats
+}
+
+func valueOrUnknown(value string) string {
+	if value == "" {
+		return "Unknown"
+	}
+	return value
+}
+
+// sortedCounts returns the counts ordered from highest to lowest, limited to top entries if top is positive.
+// Entries with a count of zero are left out.
+func sortedCounts(counts map[string]int, top int) []StatsCount {
+	var result []StatsCount
+	for name, count := range counts {
+		if count > 0 {
+			result = append(result, StatsCount{name, count})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Name < result[j].Name
+	})
+	if top > 0 && len(result) > top {
+		result = result[:top]
+	}
+	return result
+}
+
+func sortedByName(counts map[string]int) []StatsCount {
+	var result []StatsCount
+	for name, count := range counts {
+		result = append(result, StatsCount{name, count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+func writeStatsText(w io.Writer, stats *LibraryStats) error {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "Tracks: %v\n", stats.TotalTracks)
+	fmt.Fprintf(b, "Duration: %v\n", (time.Duration(stats.TotalTime) * time.Millisecond).Round(time.Second))
+	fmt.Fprintf(b, "Size: %.1f GB\n", float64(stats.TotalSize)/(1<<30))
+	fmt.Fprintf(b, "Never Played: %v\n", stats.NeverPlayed)
+
+	sections := []struct {
+		title  string
+		counts []StatsCount
+	}{
+		{"Kind", stats.ByKind},
+		{"Genre", stats.ByGenre},
+		{"Year", stats.ByYear},
+		{"Decade", stats.ByDecade},
+		{"Top Artists by Plays", stats.TopArtists},
+		{"Top Albums by Plays", stats.TopAlbums},
+		{"Ratings", stats.Ratings},
+		{"Most Skipped", stats.MostSkipped},
+		{"Tracks per Playlist", stats.TracksPerPlaylist},
+	}
+	for _, section := range sections {
+		fmt.Fprintf(b, "\n%v:\n", section.title)
+		for _, count := range section.counts {
+			fmt.Fprintf(b, "  %8d  %v\n", count.Count, count.Name)
+		}
+	}
+
+	fmt.Fprintf(b, "\nGrowth:\n")
+	for _, month := range stats.Growth {
+		fmt.Fprintf(b, "  %v  %8d added  %8d total\n", month.Month, month.Added, month.Total)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeStatsJSON(w io.Writer, stats *LibraryStats) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(stats)
+}
+
+func writeStatsCSV(w io.Writer, stats *LibraryStats) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"section", "name", "value"})
+	writer.Write([]string{"total", "tracks", strconv.Itoa(stats.TotalTracks)})
+	writer.Write([]string{"total", "timeMs", strconv.FormatInt(stats.TotalTime, 10)})
+	writer.Write([]string{"total", "sizeBytes", strconv.FormatInt(stats.TotalSize, 10)})
+	writer.Write([]string{"total", "neverPlayed", strconv.Itoa(stats.NeverPlayed)})
+
+	sections := []struct {
+		name   string
+		counts []StatsCount
+	}{
+		{"kind", stats.ByKind},
+		{"genre", stats.ByGenre},
+		{"year", stats.ByYear},
+		{"decade", stats.ByDecade},
+		{"topArtist", stats.TopArtists},
+		{"topAlbum", stats.TopAlbums},
+		{"rating", stats.Ratings},
+		{"mostSkipped", stats.MostSkipped},
+		{"playlist", stats.TracksPerPlaylist},
+	}
+	for _, section := range sections {
+		for _, count := range section.counts {
+			writer.Write([]string{section.name, count.Name, strconv.Itoa(count.Count)})
+		}
+	}
+	for _, month := range stats.Growth {
+		writer.Write([]string{"added", month.Month, strconv.Itoa(month.Added)})
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
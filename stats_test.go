@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBuildLibraryStats(t *testing.T) {
+	library := &Library{
+		Tracks: map[string]Track{
+			"1": {Name: "A", Artist: "Alpha", Genre: "Rock", Year: 1994, TotalTime: 60000, PlayCount: 5, Rating: 100,
+				DateAdded: time.Date(2020, 1, 5, 0, 0, 0, 0, time.UTC)},
+			"2": {Name: "B", Artist: "Alpha", Genre: "Rock", Year: 2001, TotalTime: 30000, PlayCount: 2, SkipCount: 3,
+				DateAdded: time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)},
+			"3": {Name: "C", Artist: "Beta", Genre: "Jazz", TotalTime: 30000},
+		},
+		Playlists: []Playlist{
+			{Name: "Folder", Folder: true},
+			{Name: "Mix", PlaylistItems: []PlaylistItem{{TrackId: 1}, {TrackId: 2}}},
+		},
+	}
+
+	stats := buildLibraryStats(library, 1)
+
+	if stats.TotalTracks != 3 || stats.TotalTime != 120000 {
+		t.Errorf("unexpected totals: %v tracks, %v ms", stats.TotalTracks, stats.TotalTime)
+	}
+	if stats.NeverPlayed != 1 {
+		t.Errorf("expected 1 never played track, got %v", stats.NeverPlayed)
+	}
+	if len(stats.TopArtists) != 1 || stats.TopArtists[0] != (StatsCount{"Alpha", 7}) {
+		t.Errorf("unexpected top artists: %v", stats.TopArtists)
+	}
+	if stats.ByGenre[0] != (StatsCount{"Rock", 2}) {
+		t.Errorf("unexpected genres: %v", stats.ByGenre)
+	}
+	if len(stats.ByDecade) != 3 || stats.ByDecade[0] != (StatsCount{"1990s", 1}) {
+		t.Errorf("unexpected decades: %v", stats.ByDecade)
+	}
+	if len(stats.TracksPerPlaylist) != 1 || stats.TracksPerPlaylist[0] != (StatsCount{"Mix", 2}) {
+		t.Errorf("unexpected playlists: %v", stats.TracksPerPlaylist)
+	}
+	if len(stats.Growth) != 2 || stats.Growth[1] != (StatsGrowth{"2020-03", 1, 2}) {
+		t.Errorf("unexpected growth: %v", stats.Growth)
+	}
+}
+
+func TestStatsCommandUnknownFormatLeavesOutput(t *testing.T) {
+	dir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "stats.txt")
+	writeFile(t, output, "previous")
+
+	if err := statsCommand([]string{"-format", "xml", "-output", output}); err == nil || err.Error() != "Unknown Format: xml" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if readFile(t, output) != "previous" {
+		t.Error("expected the output file to be left untouched")
+	}
+}
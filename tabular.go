@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A trackColumn is a Track field that can be written to a CSV or TSV listing.
+type trackColumn struct {
+	name  string
+	value func(track *Track, fileLocation string) string
+}
+
+// DefaultColumns are the columns written when none are selected with -columns.
+const DefaultColumns = "name,artist,album,genre,year,time,location"
+
+var trackColumns = []trackColumn{
+	{"trackid", func(t *Track, _ string) string { return strconv.Itoa(t.TrackId) }},
+	{"persistentid", func(t *Track, _ string) string { return t.PersistentId }},
+	{"name", func(t *Track, _ string) string { return t.Name }},
+	{"artist", func(t *Track, _ string) string { return t.Artist }},
+	{"albumartist", func(t *Track, _ string) string { return t.AlbumArtist }},
+	{"composer", func(t *Track, _ string) string { return t.Composer }},
+	{"album", func(t *Track, _ string) string { return t.Album }},
+	{"genre", func(t *Track, _ string) string { return t.Genre }},
+	{"kind", func(t *Track, _ string) string { return t.Kind }},
+	{"year", func(t *Track, _ string) string { return formatInt(t.Year) }},
+	{"tracknumber", func(t *Track, _ string) string { return formatInt(t.TrackNumber) }},
+	{"discnumber", func(t *Track, _ string) string { return formatInt(t.DiscNumber) }},
+	{"time", func(t *Track, _ string) string { return formatTrackTime(t.TotalTime) }},
+	{"totaltime", func(t *Track, _ string) string { return strconv.Itoa(t.TotalTime) }},
+	{"starttime", func(t *Track, _ string) string { return formatInt(t.StartTime) }},
+	{"stoptime", func(t *Track, _ string) string { return formatInt(t.StopTime) }},
+	{"rating", func(t *Track, _ string) string { return strconv.Itoa(t.Rating / 20) }},
+	{"playcount", func(t *Track, _ string) string { return strconv.Itoa(t.PlayCount) }},
+	{"skipcount", func(t *Track, _ string) string { return strconv.Itoa(t.SkipCount) }},
+	{"dateadded", func(t *Track, _ string) string { return formatDate(t.DateAdded) }},
+	{"datemodified", func(t *Track, _ string) string { return formatDate(t.DateModified) }},
+	{"playdate", func(t *Track, _ string) string { return formatDate(t.PlayDateUTC) }},
+	{"skipdate", func(t *Track, _ string) string { return formatDate(t.SkipDate) }},
+	{"comments", func(t *Track, _ string) string { return t.Comments }},
+	{"grouping", func(t *Track, _ string) string { return t.Grouping }},
+	{"location", func(_ *Track, fileLocation string) string { return fileLocation }},
+}
+
+// parseColumns returns the columns named in the comma separated list, in the order given.
+func parseColumns(list string) ([]trackColumn, error) {
+	var columns []trackColumn
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, column := range trackColumns {
+			if column.name == name {
+				columns = append(columns, column)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.New("Unknown Column: " + name)
+		}
+	}
+	if len(columns) == 0 {
+		return nil, errors.New("no columns selected")
+	}
+	return columns, nil
+}
+
+func columnNames(columns []trackColumn) []string {
+	var names []string
+	for _, column := range columns {
+		names = append(names, column.name)
+	}
+	return names
+}
+
+func columnValues(columns []trackColumn, track *Track, fileLocation string) []string {
+	var values []string
+	for _, column := range columns {
+		values = append(values, column.value(track, fileLocation))
+	}
+	return values
+}
+
+func formatInt(value int) string {
+	if value == 0 {
+		return ""
+	}
+	return strconv.Itoa(value)
+}
+
+// formatTrackTime formats a time in milliseconds as minutes and seconds.
+func formatTrackTime(ms int) string {
+	seconds := ms / 1000
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+func formatDate(date time.Time) string {
+	if date.IsZero() {
+		return ""
+	}
+	return date.UTC().Format(time.RFC3339)
+}
+
+// csvPlaylistWriters write one row per playlist entry, separated by comma, with a header row
+// naming the selected columns.
+func csvPlaylistWriters(comma rune) (header playlistWriter, entry trackWriter, footer playlistWriter) {
+
+	writeRow := func(w io.Writer, row []string) error {
+		writer := csv.NewWriter(w)
+		writer.Comma = comma
+		writer.Write(row)
+		writer.Flush()
+		return writer.Error()
+	}
+
+	header = func(w io.Writer, exportSettings *ExportSettings, _ *Playlist) error {
+		return writeRow(w, columnNames(exportSettings.Columns))
+	}
+
+	entry = func(w io.Writer, exportSettings *ExportSettings, _ *Playlist, track *Track, fileLocation string, _ string) error {
+		return writeRow(w, columnValues(exportSettings.Columns, track, fileLocation))
+	}
+
+	footer = func(_ io.Writer, _ *ExportSettings, _ *Playlist) error {
+		return nil
+	}
+
+	return
+}
+
+// tracksCommand lists the tracks of the library, or of a single playlist or folder, as CSV, TSV, text or JSON.
+func tracksCommand(args []string) error {
+	var libraryPath, playlistName, columnList, format, output string
+	flags := newCommandFlags("tracks", &libraryPath)
+	flags.StringVar(&playlistName, "playlist", "", "")
+	flags.StringVar(&columnList, "columns", DefaultColumns, "")
+	flags.StringVar(&format, "format", "csv", "")
+	flags.StringVar(&output, "output", "", "")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	format = strings.ToLower(format)
+	if format != "csv" && format != "tsv" && format != "text" && format != "json" {
+		return errors.New("Unknown Format: " + format)
+	}
+	columns, err := parseColumns(columnList)
+	if err != nil {
+		return err
+	}
+
+	library, err := loadCommandLibrary(libraryPath)
+	if err != nil {
+		return err
+	}
+	tracks := sortedLibraryTracks(library)
+	if playlistName != "" {
+		playlist, err := findListPlaylist(library, playlistName)
+		if err != nil {
+			return err
+		}
+		tracks = playlist.Tracks(library)
+	}
+
+	w, closeOutput, err := commandOutput(output)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "csv":
+		err = writeTracksDelimited(w, ',', columns, tracks)
+	case "tsv":
+		err = writeTracksDelimited(w, '\t', columns, tracks)
+	case "text":
+		err = writeTracksText(w, columns, tracks)
+	case "json":
+		err = writeTracksJSON(w, columns, tracks)
+	}
+	if closeErr := closeOutput(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+
+	id3v2 "github.com/bogem/id3v2/v2"
+	"github.com/go-flac/flacvorbis"
+	flac "github.com/go-flac/go-flac"
+)
+
+// TagFields lists the Track fields that can be written into the tags of copied files.
+var TagFields = []string{"name", "artist", "albumartist", "album", "genre", "comments", "grouping", "work", "rating", "playcount"}
+
+// The POPM email used by Windows Media Player, which is the one most other players read.
+const popularimeterEmail = "Windows Media Player 9 Series"
+
+// trackTagValues returns the selected fields of the track as strings, keyed by field name.
+// Empty values are left out so curation already present in the file is not cleared.
+// Ratings keep the iTunes 0-100 scale.
+func trackTagValues(track *Track, fields []string) map[string]string {
+	values := make(map[string]string)
+	for _, field := range fields {
+		var value string
+		switch field {
+		case "name":
+			value = track.Name
+		case "artist":
+			value = track.Artist
+		case "albumartist":
+			value = track.AlbumArtist
+		case "album":
+			value = track.Album
+		case "genre":
+			value = track.Genre
+		case "comments":
+			value = track.Comments
+		case "grouping":
+			value = track.Grouping
+		case "work":
+			value = track.Work
+		case "rating":
+			if track.Rating > 0 {
+				value = strconv.Itoa(track.Rating)
+			}
+		case "playcount":
+			if track.PlayCount > 0 {
+				value = strconv.Itoa(track.PlayCount)
+			}
+		}
+		if value != "" {
+			values[field] = value
+		}
+	}
+	return values
+}
+
+// writeTrackTags writes the selected fields of the track into the tags of the music file at dest.
+// The format of the file is given by ext, the extension of its final name, e.g. .mp3, as dest may be a
+// temporary file. It must only ever be called for copies, never for the original files in the library.
+// Files in formats without tag support are left unchanged.
+func writeTrackTags(dest string, ext string, track *Track, fields []string) error {
+	values := trackTagValues(track, fields)
+	if len(values) == 0 {
+		return nil
+	}
+
+	switch strings.ToLower(ext) {
+	case ".mp3":
+		return writeID3Tags(dest, values)
+	case ".m4a", ".m4b", ".m4p", ".m4v", ".mp4", ".aac":
+		return writeMP4Tags(dest, values)
+	case ".flac":
+		return writeVorbisTags(dest, values)
+	}
+	return nil
+}
+
+var id3TextFrames = map[string]string{
+	"name":        "TIT2",
+	"artist":      "TPE1",
+	"albumartist": "TPE2",
+	"album":       "TALB",
+	"genre":       "TCON",
+	"grouping":    "GRP1",
+	"work":        "TIT1",
+}
+
+func writeID3Tags(dest string, values map[string]string) error {
+	tag, err := id3v2.Open(dest, id3v2.Options{Parse: true})
+	if err != nil {
+		return err
+	}
+	defer tag.Close()
+
+	encoding := tag.DefaultEncoding()
+	for field, id := range id3TextFrames {
+		if value, ok := values[field]; ok {
+			tag.DeleteFrames(id)
+			tag.AddTextFrame(id, encoding, value)
+		}
+	}
+
+	if value, ok := values["comments"]; ok {
+		tag.AddCommentFrame(id3v2.CommentFrame{Encoding: encoding, Language: "eng", Text: value})
+	}
+
+	_, hasRating := values["rating"]
+	_, hasPlayCount := values["playcount"]
+	if hasRating || hasPlayCount {
+		popm := id3v2.PopularimeterFrame{Email: popularimeterEmail, Counter: big.NewInt(0)}
+		for _, frame := range tag.GetFrames(tag.CommonID("Popularimeter")) {
+			if existing, ok := frame.(id3v2.PopularimeterFrame); ok && existing.Email == popularimeterEmail {
+				popm = existing
+			}
+		}
+		if hasRating {
+			rating, _ := strconv.Atoi(values["rating"])
+			popm.Rating = popularimeterRating(rating)
+		}
+		if hasPlayCount {
+			playCount, _ := strconv.ParseInt(values["playcount"], 10, 64)
+			popm.Counter = big.NewInt(playCount)
+		}
+		tag.AddFrame(tag.CommonID("Popularimeter"), popm)
+	}
+
+	return tag.Save()
+}
+
+// popularimeterRating converts an iTunes 0-100 rating into the 1-255 POPM scale used by Windows Media Player.
+func popularimeterRating(rating int) uint8 {
+	switch {
+	case rating <= 0:
+		return 0
+	case rating <= 20:
+		return 1
+	case rating <= 40:
+		return 64
+	case rating <= 60:
+		return 128
+	case rating <= 80:
+		return 196
+	default:
+		return 255
+	}
+}
+
+var vorbisCommentNames = map[string]string{
+	"name":        "TITLE",
+	"artist":      "ARTIST",
+	"albumartist": "ALBUMARTIST",
+	"album":       "ALBUM",
+	"genre":       "GENRE",
+	"comments":    "COMMENT",
+	"grouping":    "GROUPING",
+	"work":        "WORK",
+	"rating":      "RATING",
+	"playcount":   "PLAYCOUNT",
+}
+
+func writeVorbisTags(dest string, values map[string]string) error {
+	file, err := flac.ParseFile(dest)
+	if err != nil {
+		return err
+	}
+
+	var comments *flacvorbis.MetaDataBlockVorbisComment
+	commentsIndex := -1
+	for i, meta := range file.Meta {
+		if meta.Type == flac.VorbisComment {
+			comments, err = flacvorbis.ParseFromMetaDataBlock(*meta)
+			if err != nil {
+				return err
+			}
+			commentsIndex = i
+			break
+		}
+	}
+	if comments == nil {
+		comments = flacvorbis.New()
+	}
+
+	for field, value := range values {
+		name := vorbisCommentNames[field]
+		var kept []string
+		for _, comment := range comments.Comments {
+			if !strings.HasPrefix(strings.ToUpper(comment), name+"=") {
+				kept = append(kept, comment)
+			}
+		}
+		comments.Comments = kept
+		if err = comments.Add(name, value); err != nil {
+			return err
+		}
+	}
+
+	block := comments.Marshal()
+	if commentsIndex >= 0 {
+		file.Meta[commentsIndex] = &block
+	} else {
+		file.Meta = append(file.Meta, &block)
+	}
+
+	info, err := os.Stat(dest)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return errors.New("destination file is not a regular file")
+	}
+	return os.WriteFile(dest, file.Marshal(), info.Mode().Perm())
+}
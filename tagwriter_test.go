@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dhowden/tag"
+)
+
+func TestWriteMP4Tags(t *testing.T) {
+	dir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(dir)
+
+	// ftyp, then a moov whose single chunk offset points at the media data in the following mdat.
+	ftyp := (&mp4Atom{kind: "ftyp", data: []byte("M4A \x00\x00\x00\x00M4A mp42isom")}).marshal()
+	stco := &mp4Atom{kind: "stco", data: make([]byte, 12)}
+	binary.BigEndian.PutUint32(stco.data[4:], 1)
+	moov := &mp4Atom{kind: "moov", children: []*mp4Atom{
+		{kind: "trak", children: []*mp4Atom{
+			{kind: "mdia", children: []*mp4Atom{
+				{kind: "minf", children: []*mp4Atom{
+					{kind: "stbl", children: []*mp4Atom{stco}},
+				}},
+			}},
+		}},
+	}}
+	mediaOffset := len(ftyp) + len(moov.marshal()) + 8
+	binary.BigEndian.PutUint32(stco.data[8:], uint32(mediaOffset))
+	mdat := (&mp4Atom{kind: "mdat", data: []byte(FileContent)}).marshal()
+
+	fileName := filepath.Join(dir, "song.m4a")
+	content := append(append(ftyp, moov.marshal()...), mdat...)
+	if err := os.WriteFile(fileName, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	track := &Track{Name: "Corrected Name", Comments: "Curated", Rating: 80}
+	if err := writeTrackTags(fileName, filepath.Ext(fileName), track, TagFields); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	metadata, err := tag.ReadFrom(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Title() != "Corrected Name" || metadata.Comment() != "Curated" {
+		t.Errorf("unexpected tags, title: %q, comment: %q", metadata.Title(), metadata.Comment())
+	}
+
+	written := readFile(t, fileName)
+	atoms, err := readMP4TopLevelAtoms(file, int64(len(written)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := parseMP4Atom([]byte(written[atoms[1].offset : atoms[1].offset+atoms[1].size]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newStco := root.child("trak").child("mdia").child("minf").child("stbl").child("stco")
+	newOffset := binary.BigEndian.Uint32(newStco.data[8:])
+	if written[newOffset:newOffset+uint32(len(FileContent))] != FileContent {
+		t.Error("expected the chunk offset to still point at the media data")
+	}
+}
+
+func TestWriteMP4TagsKeeps64BitAtomSizes(t *testing.T) {
+	dir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(dir)
+
+	ftyp := (&mp4Atom{kind: "ftyp", data: []byte("M4A \x00\x00\x00\x00M4A mp42isom")}).marshal()
+	stco := &mp4Atom{kind: "stco", data: make([]byte, 12)}
+	binary.BigEndian.PutUint32(stco.data[4:], 1)
+	moov := &mp4Atom{kind: "moov", largeSize: true, children: []*mp4Atom{
+		{kind: "trak", largeSize: true, children: []*mp4Atom{stco}},
+	}}
+	mediaOffset := len(ftyp) + len(moov.marshal()) + 16
+	binary.BigEndian.PutUint32(stco.data[8:], uint32(mediaOffset))
+	mdat := (&mp4Atom{kind: "mdat", largeSize: true, data: []byte(FileContent)}).marshal()
+
+	fileName := filepath.Join(dir, "song.m4a")
+	content := append(append(ftyp, moov.marshal()...), mdat...)
+	if err := os.WriteFile(fileName, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeTrackTags(fileName, filepath.Ext(fileName), &Track{Name: "Corrected Name"}, []string{"name"}); err != nil {
+		t.Fatal(err)
+	}
+
+	written := readFile(t, fileName)
+	atoms, err := readMP4TopLevelAtoms(strings.NewReader(written), int64(len(written)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := parseMP4Atom([]byte(written[atoms[1].offset : atoms[1].offset+atoms[1].size]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !root.largeSize || !root.child("trak").largeSize || root.child("udta").largeSize {
+		t.Error("expected only the atoms with a 64-bit size to keep it")
+	}
+	newOffset := binary.BigEndian.Uint32(root.child("trak").child("stco").data[8:])
+	if written[newOffset:newOffset+uint32(len(FileContent))] != FileContent {
+		t.Error("expected the chunk offset to still point at the media data")
+	}
+}
+
+func TestWriteMP4TagsRefusesFragmentedFiles(t *testing.T) {
+	dir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(dir)
+
+	ftyp := (&mp4Atom{kind: "ftyp", data: []byte("M4A \x00\x00\x00\x00M4A mp42isom")}).marshal()
+	moov := (&mp4Atom{kind: "moov", children: []*mp4Atom{{kind: "mvex", data: []byte{}}}}).marshal()
+	moof := (&mp4Atom{kind: "moof", data: make([]byte, 8)}).marshal()
+	mdat := (&mp4Atom{kind: "mdat", data: []byte(FileContent)}).marshal()
+
+	for name, content := range map[string][]byte{
+		"moof.m4a": append(append(append(ftyp, moov...), moof...), mdat...),
+		"mvex.m4a": append(append(ftyp, moov...), mdat...),
+	} {
+		fileName := filepath.Join(dir, name)
+		if err := os.WriteFile(fileName, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeTrackTags(fileName, filepath.Ext(fileName), &Track{Name: "Corrected Name"}, []string{"name"}); err != errFragmentedMP4 {
+			t.Errorf("%v: expected the fragmented file to be refused, got %v", name, err)
+		}
+		if readFile(t, fileName) != string(content) {
+			t.Errorf("%v: expected the fragmented file to be left untagged", name)
+		}
+	}
+}
+
+// Copies are tagged while they still have their temporary name, which lacks the media extension.
+func TestExportTagsCopies(t *testing.T) {
+	musicDir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(musicDir)
+	outputDir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(outputDir)
+	writeFile(t, filepath.Join(musicDir, "song.mp3"), strings.Repeat(FileContent, 32))
+
+	library := &Library{
+		Tracks: map[string]Track{"1": {TrackId: 1, Name: "Corrected Name", Location: "file://" + filepath.ToSlash(musicDir) + "/song.mp3"}},
+	}
+	exportSettings := &ExportSettings{
+		Library:       library,
+		Playlists:     []Playlist{{Name: "Mix", PlaylistItems: []PlaylistItem{{TrackId: 1}}}},
+		ExportType:    M3U,
+		Extension:     "m3u",
+		OutputPath:    outputDir,
+		CopyType:      COPY_FLAT,
+		PathSeparator: "/",
+		TagFields:     []string{"name"},
+	}
+	if err := ExportPlaylists(context.Background(), exportSettings, library); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(filepath.Join(outputDir, "song.mp3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	metadata, err := tag.ReadFrom(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Title() != "Corrected Name" {
+		t.Errorf("expected the copy to be tagged, got title %q", metadata.Title())
+	}
+}
+
+func TestWriteID3Tags(t *testing.T) {
+	dir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(dir)
+
+	// Real MP3 files are always longer than an ID3 header.
+	fileName := filepath.Join(dir, "song.mp3")
+	writeFile(t, fileName, strings.Repeat(FileContent, 32))
+
+	track := &Track{Name: "Corrected Name", Artist: "Artist", Rating: 100, PlayCount: 7}
+	if err := writeTrackTags(fileName, filepath.Ext(fileName), track, []string{"name", "artist", "rating"}); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	metadata, err := tag.ReadFrom(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Title() != "Corrected Name" || metadata.Artist() != "Artist" {
+		t.Errorf("unexpected tags, title: %q, artist: %q", metadata.Title(), metadata.Artist())
+	}
+	if _, ok := metadata.Raw()["POPM"]; !ok {
+		t.Error("expected a POPM frame for the rating")
+	}
+}
+
+func TestPopularimeterRating(t *testing.T) {
+	expected := map[int]uint8{0: 0, 20: 1, 40: 64, 60: 128, 80: 196, 100: 255}
+	for rating, popm := range expected {
+		if popularimeterRating(rating) != popm {
+			t.Errorf("expected rating %v to map to %v, got %v", rating, popm, popularimeterRating(rating))
+		}
+	}
+}
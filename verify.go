@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ManifestFileName is the file in the output directory that lists the size and sha256 of every verified copy.
+const ManifestFileName = ".itunesexport-manifest"
+
+// verifyAttempts is how often a copy is made before a checksum mismatch is reported as an error.
+const verifyAttempts = 3
+
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+// ManifestEntry is the size and sha256 of a file in the output directory.
+type ManifestEntry struct {
+	Size int64
+	Sum  string
+}
+
+// Manifest records the verified copies in an output directory, keyed by their path relative to it,
+// so the copies can be verified again later without the source files.
+type Manifest struct {
+	root    string
+	entries map[string]ManifestEntry
+}
+
+// loadManifest reads the manifest of the output directory. A missing manifest results in an empty one.
+func loadManifest(outputPath string) (*Manifest, error) {
+	manifest := &Manifest{root: outputPath, entries: make(map[string]ManifestEntry)}
+	file, err := os.Open(filepath.Join(outputPath, ManifestFileName))
+	if os.IsNotExist(err) {
+		return manifest, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		manifest.entries[fields[2]] = ManifestEntry{size, fields[0]}
+	}
+	return manifest, scanner.Err()
+}
+
+// Save writes the manifest into the output directory, one "sha256 TAB size TAB path" line per file.
+func (m *Manifest) Save() error {
+	paths := make([]string, 0, len(m.entries))
+	for path := range m.entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	file, err := createAtomicFile(filepath.Join(m.root, ManifestFileName), 0)
+	if err != nil {
+		return err
+	}
+	defer file.Abort()
+
+	w := bufio.NewWriter(file)
+	for _, path := range paths {
+		entry := m.entries[path]
+		fmt.Fprintf(w, "%v\t%v\t%v\n", entry.Sum, entry.Size, path)
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	return file.Commit(nil)
+}
+
+// Get returns the entry of the file at path.
+func (m *Manifest) Get(path string) (ManifestEntry, bool) {
+	entry, ok := m.entries[m.key(path)]
+	return entry, ok
+}
+
+// Set records the size and sha256 of the file at path.
+func (m *Manifest) Set(path string, entry ManifestEntry) {
+	m.entries[m.key(path)] = entry
+}
+
+func (m *Manifest) key(path string) string {
+	rel, err := filepath.Rel(m.root, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// fileChecksum reads the file at path and returns its size and sha256.
+func fileChecksum(path string) (ManifestEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+	return ManifestEntry{size, hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// verifyExistingFile reports whether an existing copy at dest is intact. A copy in the manifest must match
+// its entry. Otherwise it must match src, unless it was tagged, and it is added to the manifest.
+func verifyExistingFile(manifest *Manifest, src string, dest string, tagged bool) (bool, error) {
+	destSum, err := fileChecksum(dest)
+	if err != nil {
+		return false, err
+	}
+	if entry, ok := manifest.Get(dest); ok {
+		return entry == destSum, nil
+	}
+	if !tagged {
+		srcSum, err := fileChecksum(src)
+		if err != nil {
+			return false, err
+		}
+		if srcSum != destSum {
+			return false, nil
+		}
+	}
+	manifest.Set(dest, destSum)
+	return true, nil
+}
+
+// verifyCommand checks every file in the manifest of an output directory, without the source files.
+func verifyCommand(args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	positional, err := parseCommandArgs(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errors.New("usage: verify <output folder>")
+	}
+
+	manifest, err := loadManifest(positional[0])
+	if err != nil {
+		return err
+	}
+	if len(manifest.entries) == 0 {
+		return fmt.Errorf("no %v found in %v", ManifestFileName, positional[0])
+	}
+
+	problems := verifyManifest(manifest)
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	fmt.Printf("Verified %v files, %v problems found.\n", len(manifest.entries), len(problems))
+	if len(problems) > 0 {
+		return errors.New("verification failed")
+	}
+	return nil
+}
+
+// verifyManifest checks the files in the manifest and describes every file that is missing or differs.
+func verifyManifest(manifest *Manifest) []string {
+	paths := make([]string, 0, len(manifest.entries))
+	for path := range manifest.entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var problems []string
+	for _, path := range paths {
+		entry := manifest.entries[path]
+		sum, err := fileChecksum(filepath.Join(manifest.root, filepath.FromSlash(path)))
+		switch {
+		case os.IsNotExist(err):
+			problems = append(problems, "Missing: "+path)
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("Unreadable: %v: %v", path, err))
+		case sum.Size != entry.Size:
+			problems = append(problems, fmt.Sprintf("Size mismatch: %v: %v bytes, expected %v", path, sum.Size, entry.Size))
+		case sum.Sum != entry.Sum:
+			problems = append(problems, "Checksum mismatch: "+path)
+		}
+	}
+	return problems
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyFileVerifiesAndRecordsManifest(t *testing.T) {
+	outputDir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(outputDir)
+	src := filepath.Join(outputDir, "song.mp3")
+	writeFile(t, src, FileContent)
+
+	copiesDir := filepath.Join(outputDir, "copies")
+	dest := filepath.Join(copiesDir, "Artist", "song.mp3")
+	manifest, err := loadManifest(copiesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = copyFile(context.Background(), src, dest, copyOptions{manifest: manifest}); err != nil {
+		t.Fatal(err)
+	}
+	if err = manifest.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err = loadManifest(copiesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, ok := manifest.entries["Artist/song.mp3"]
+	if !ok || entry.Size != int64(len(FileContent)) {
+		t.Fatalf("expected the copy in the manifest, found %v", manifest.entries)
+	}
+	if problems := verifyManifest(manifest); len(problems) != 0 {
+		t.Errorf("expected no problems, found %v", problems)
+	}
+
+	// A corrupted copy is reported, and copied again by the next export.
+	writeFile(t, dest, "43")
+	if problems := verifyManifest(manifest); len(problems) != 1 || problems[0] != "Checksum mismatch: Artist/song.mp3" {
+		t.Errorf("expected a checksum mismatch, found %v", problems)
+	}
+	copied, err := copyFile(context.Background(), src, dest, copyOptions{manifest: manifest})
+	if err != nil || !copied {
+		t.Fatalf("expected the corrupted copy to be replaced, got %v, %v", copied, err)
+	}
+	if readFile(t, dest) != FileContent {
+		t.Error("expected the copy to match the source")
+	}
+
+	os.Remove(dest)
+	if problems := verifyManifest(manifest); len(problems) != 1 || problems[0] != "Missing: Artist/song.mp3" {
+		t.Errorf("expected a missing file, found %v", problems)
+	}
+}
+
+func TestCopyFileRecordsTaggedCopyInManifest(t *testing.T) {
+	outputDir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(outputDir)
+	src := filepath.Join(outputDir, "song.mp3")
+	writeFile(t, src, FileContent)
+
+	dest := filepath.Join(outputDir, "copies", "song.mp3")
+	manifest, err := loadManifest(filepath.Join(outputDir, "copies"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag := func(path string) error {
+		return os.WriteFile(path, []byte(FileContent+"tagged"), 0666)
+	}
+	if _, err = copyFile(context.Background(), src, dest, copyOptions{manifest: manifest, prepare: tag}); err != nil {
+		t.Fatal(err)
+	}
+
+	sum, err := fileChecksum(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, _ := manifest.Get(dest); entry != sum {
+		t.Errorf("expected the manifest to record the tagged copy %v, found %v", sum, entry)
+	}
+	if ok, err := verifyExistingFile(manifest, src, dest, true); err != nil || !ok {
+		t.Errorf("expected the tagged copy to verify, got %v, %v", ok, err)
+	}
+}
+
+// With -verify, the copies of an unchanged playlist are still checked, and a corrupt copy is restored.
+func TestExportRestoresCorruptCopyOfUnchangedPlaylist(t *testing.T) {
+	musicDir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(musicDir)
+	outputDir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(outputDir)
+	writeFile(t, filepath.Join(musicDir, "song.mp3"), FileContent)
+
+	library := &Library{
+		Tracks: map[string]Track{"1": {TrackId: 1, PersistentId: "AAA", Name: "Song", Location: "file://" + filepath.ToSlash(musicDir) + "/song.mp3"}},
+	}
+	manifest, err := loadManifest(outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exportSettings := &ExportSettings{
+		Library:        library,
+		Playlists:      []Playlist{{Name: "Mix", PlaylistPersistentId: "P1", PlaylistItems: []PlaylistItem{{TrackId: 1}}}},
+		ExportType:     M3U,
+		Extension:      "m3u",
+		OutputPath:     outputDir,
+		CopyType:       COPY_FLAT,
+		LinkMode:       LINK_COPY,
+		PathSeparator:  "/",
+		PlaylistStates: make(map[string]PlaylistState),
+		Manifest:       manifest,
+	}
+	if err = ExportPlaylists(context.Background(), exportSettings, library); err != nil {
+		t.Fatal(err)
+	}
+
+	copied := filepath.Join(outputDir, "song.mp3")
+	writeFile(t, copied, "corrupt")
+	playlistFile := filepath.Join(outputDir, "Mix.m3u")
+	writeFile(t, playlistFile, "marker")
+	if err = ExportPlaylists(context.Background(), exportSettings, library); err != nil {
+		t.Fatal(err)
+	}
+	if readFile(t, playlistFile) != "marker" {
+		t.Error("expected the unchanged playlist not to be written again")
+	}
+	if readFile(t, copied) != FileContent {
+		t.Error("expected the corrupt copy to be restored")
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchLibrary calls export whenever the library file changes, until ctx is cancelled.
+// Changes are noticed through file system notifications and, for network mounts that do not deliver
+// them, by polling the file every interval. Once a change is seen, export is called after the file
+// has not changed for delay, so a burst of writes results in a single export.
+func watchLibrary(ctx context.Context, libraryPath string, delay time.Duration, interval time.Duration, export func() error) error {
+	changes := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		defer watcher.Close()
+		// iTunes replaces the library file rather than rewriting it, so the directory is watched.
+		err = watcher.Add(filepath.Dir(libraryPath))
+	}
+	if err != nil {
+		fmt.Printf("Unable to watch %v for changes, polling every %v instead: %v\n", libraryPath, interval, err)
+		watcher = nil
+	} else {
+		go func() {
+			for event := range watcher.Events {
+				if filepath.Clean(event.Name) == libraryPath {
+					notify()
+				}
+			}
+		}()
+		go func() {
+			for err := range watcher.Errors {
+				fmt.Printf("Error watching %v: %v\n", libraryPath, err)
+			}
+		}()
+	}
+
+	go pollLibrary(ctx, libraryPath, interval, notify)
+
+	fmt.Printf("Watching %v for changes.\n", libraryPath)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changes:
+		}
+		if !waitForQuiet(ctx, changes, delay) {
+			return nil
+		}
+		fmt.Printf("\nLibrary changed, exporting again.\n")
+		if err := export(); err != nil {
+			fmt.Println(err)
+		}
+		fmt.Printf("Watching %v for changes.\n", libraryPath)
+	}
+}
+
+// waitForQuiet returns true once no change has been seen for delay, or false if ctx is cancelled first.
+func waitForQuiet(ctx context.Context, changes <-chan struct{}, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-changes:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(delay)
+		case <-timer.C:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// pollLibrary calls notify whenever the size or modification time of the library file changes,
+// until ctx is cancelled. An interval of zero disables polling.
+func pollLibrary(ctx context.Context, libraryPath string, interval time.Duration, notify func()) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last, _ := os.Stat(libraryPath)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(libraryPath)
+		if err != nil {
+			continue
+		}
+		if last == nil || info.Size() != last.Size() || !info.ModTime().Equal(last.ModTime()) {
+			notify()
+		}
+		last = info
+	}
+}
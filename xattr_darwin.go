@@ -0,0 +1,10 @@
+package main
+
+import "errors"
+
+const xattrsSupported = false
+
+// copyXattrs is not supported on this platform.
+func copyXattrs(src string, dest string) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"syscall"
+)
+
+const xattrsSupported = true
+
+// copyXattrs copies the extended attributes of src to dest.
+func copyXattrs(src string, dest string) error {
+	size, err := syscall.Listxattr(src, nil)
+	if err != nil || size == 0 {
+		return err
+	}
+	names := make([]byte, size)
+	size, err = syscall.Listxattr(src, names)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range strings.Split(string(names[:size]), "\x00") {
+		if name == "" {
+			continue
+		}
+		size, err := syscall.Getxattr(src, name, nil)
+		if err != nil {
+			return err
+		}
+		value := make([]byte, size)
+		size, err = syscall.Getxattr(src, name, value)
+		if err != nil {
+			return err
+		}
+		if err = syscall.Setxattr(dest, name, value[:size], 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
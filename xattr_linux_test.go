@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestCopyFileCopiesXattrs(t *testing.T) {
+	outputDir := createTempDir(t, "itunes-exporter-test")
+	defer os.RemoveAll(outputDir)
+	src := filepath.Join(outputDir, "song.mp3")
+	writeFile(t, src, FileContent)
+	if err := syscall.Setxattr(src, "user.itunesexport", []byte("42"), 0); err != nil {
+		t.Skipf("extended attributes not supported: %v", err)
+	}
+
+	dest := filepath.Join(outputDir, "copies", "song.mp3")
+	if _, err := copyFile(context.Background(), src, dest, copyOptions{xattrs: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	value := make([]byte, 16)
+	size, err := syscall.Getxattr(dest, "user.itunesexport", value)
+	if err != nil || string(value[:size]) != "42" {
+		t.Errorf("expected the extended attribute to be copied, got %q, %v", value[:size], err)
+	}
+}